@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/rs/zerolog/log"
+)
+
+// eventID returns the id of the event with the message: the hash of its
+// content, so a screen reconnecting to any instance doesn't get the same
+// content again
+func eventID(msg []byte) string {
+	var m struct {
+		Hash string `json:"hash"`
+	}
+	_ = json.Unmarshal(msg, &m)
+	return m.Hash
+}
+
+// HandleScreenEvents connects a screen through server-sent events, for
+// browsers and networks where websockets don't work. It gets the same
+// messages as websocket screens, but can't report its status.
+func (srv *Server) HandleScreenEvents(req *inout.Request) *inout.Reply {
+	title, role, token, reply := screenRequest(req)
+	if reply != nil {
+		return reply
+	}
+
+	events, err := req.Events()
+	if err != nil {
+		log.Error().Err(err).Msg("streaming events")
+		return inout.Error(http.StatusInternalServerError, "error connecting")
+	}
+
+	quit := make(chan struct{})
+	var once sync.Once
+	screen := &Screen{
+		title:     title,
+		role:      role,
+		transport: transportEvents,
+		addr:      req.RemoteAddr(),
+		token:     token,
+		stop:      func() { once.Do(func() { close(quit) }) },
+	}
+	srv.addScreen(screen)
+	scrlog := log.With().Str("deck", title).Str("client", screen.addr).Logger()
+	scrlog.Debug().Msg("connected")
+	defer func() {
+		screen.out.drop()
+		screen.shutdown()
+		scrlog.Debug().Msg("disconnected")
+	}()
+
+	// send the current content, unless the screen already got it
+	_ = events.Retry(2000)
+	if current, err := json.Marshal(srv.payload(screen, srv.get(title))); err == nil {
+		if eventID(current) != req.Header("Last-Event-ID") {
+			screen.Send(current)
+		}
+	}
+
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-screen.out.ready:
+			msg := screen.out.take()
+			if msg == nil {
+				continue
+			}
+			if err := events.Send(eventID(msg), msg); err != nil {
+				return inout.Handled()
+			}
+			screen.sent(msg)
+
+		case <-ticker.C:
+			if err := events.Comment("ping"); err != nil {
+				return inout.Handled()
+			}
+
+		case <-events.Done():
+			return inout.Handled()
+
+		case <-quit:
+			return inout.Handled()
+		}
+	}
+}
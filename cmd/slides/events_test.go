@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/paupin2/slides/pkg/data"
+)
+
+// readEvent returns the id and data of the next event, skipping comments
+// and retry fields
+func readEvent(t *testing.T, r *bufio.Reader) (id, msg string) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = line[4:]
+		case strings.HasPrefix(line, "data: "):
+			msg += line[6:]
+		case line == "" && msg != "":
+			return id, msg
+		}
+	}
+}
+
+func TestScreenEvents(t *testing.T) {
+	token, _, err := data.NewScreenToken("2022-06-05", "", data.SystemUser(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newServer()
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := inout.NewRequest(w, r)
+		req.Send(srv.Handle(req))
+	}))
+	defer hs.Close()
+
+	connect := func(lastID string) *http.Response {
+		q := url.Values{"title": {"2022-06-05"}, "token": {token}}
+		r, _ := http.NewRequest(http.MethodGet, hs.URL+"/screen/events?"+q.Encode(), nil)
+		if lastID != "" {
+			r.Header.Set("Last-Event-ID", lastID)
+		}
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp, err := http.Get(hs.URL + "/screen/events?title=2022-06-05"); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", resp.StatusCode)
+	}
+
+	srv.show("2022-06-05", Presentation{Index: -1, Text: "one"})
+	resp := connect("")
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("bad content type %q", ct)
+	}
+	events := bufio.NewReader(resp.Body)
+	id, msg := readEvent(t, events)
+	if id != contentHash("one") || !strings.Contains(msg, `"text":"one"`) {
+		t.Errorf("bad first event %q: %s", id, msg)
+	}
+
+	// registered with the websocket screens
+	if infos := srv.screenInfos("2022-06-05"); len(infos) != 1 || infos[0].Transport != transportEvents {
+		t.Errorf("bad screens: %+v", infos)
+	}
+
+	srv.show("2022-06-05", Presentation{Index: -1, Text: "two"})
+	if id, msg = readEvent(t, events); id != contentHash("two") || !strings.Contains(msg, `"text":"two"`) {
+		t.Errorf("bad event %q: %s", id, msg)
+	}
+	resp.Body.Close()
+
+	// resuming with the current content only gets what's shown next
+	resp = connect(contentHash("two"))
+	defer resp.Body.Close()
+	events = bufio.NewReader(resp.Body)
+	time.Sleep(50 * time.Millisecond)
+	srv.show("2022-06-05", Presentation{Index: -1, Text: "three"})
+	if id, _ = readEvent(t, events); id != contentHash("three") {
+		t.Errorf("expected only the new content after resuming, got %q", id)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/paupin2/slides/pkg/config"
+	"github.com/paupin2/slides/pkg/data"
+	"github.com/paupin2/slides/pkg/slides"
+)
+
+// footer policies: which of a song's slides show its footer
+const (
+	footerFirstLast = "first-last" // the default
+	footerEvery     = "every"
+	footerNone      = "none"
+)
+
+// songFooter returns the attribution shown with the song's lyrics
+func songFooter(song *data.Song, licence string) string {
+	parts := []string{song.Title}
+	if song.Author != "" {
+		parts[0] += " – " + song.Author
+	}
+	if c := song.Copyright; c != "" {
+		if !strings.HasPrefix(c, "©") {
+			c = "© " + c
+		}
+		parts = append(parts, c)
+	}
+	if song.CCLI != "" {
+		parts = append(parts, fmt.Sprintf("CCLI Song #%s", song.CCLI))
+	}
+	if licence != "" {
+		parts = append(parts, fmt.Sprintf("CCLI Licence #%s", licence))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// footerOf returns the footer for the slide, if it's on a song referenced
+// with "(@id)" and the policy shows it there. A song's slides are those
+// after its header, until the next song. `songByID` returns the song, or nil.
+func footerOf(ss []slides.Slide, index int, cfg config.CCLI, songByID func(id int) *data.Song) string {
+	if index < 0 || index >= len(ss) || cfg.Footer == footerNone {
+		return ""
+	}
+
+	_, id, _ := sectionOf(ss, index)
+	if id == 0 {
+		return ""
+	}
+	if cfg.Footer != footerEvery {
+		first := index == 0
+		if !first {
+			_, prev, _ := sectionOf(ss, index-1)
+			first = prev != id || hasSongRef(ss[index])
+		}
+		last := index == len(ss)-1
+		if !last {
+			_, next, _ := sectionOf(ss, index+1)
+			last = next != id || hasSongRef(ss[index+1])
+		}
+		if !first && !last {
+			return ""
+		}
+	}
+
+	song := songByID(id)
+	if song == nil {
+		return ""
+	}
+	return songFooter(song, cfg.Licence)
+}
+
+// hasSongRef returns true if the slide starts a song, even if it's the
+// same song as the one before it
+func hasSongRef(s slides.Slide) bool {
+	for _, h := range s.Headers {
+		if _, _, found := slides.SongRef(h); found {
+			return true
+		}
+	}
+	return false
+}
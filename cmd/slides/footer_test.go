@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/paupin2/slides/pkg/config"
+	"github.com/paupin2/slides/pkg/data"
+	"github.com/paupin2/slides/pkg/slides"
+)
+
+func TestFooter(t *testing.T) {
+	ss := slides.Parse("# Welcome\n\nGood morning\n\n" +
+		"# Amazing Grace (@12)\nAmazing grace\n\nI once was lost\n\nMy chains\n\n" +
+		"# Holy (@13)\nHoly\n")
+	songByID := func(id int) *data.Song {
+		if id != 12 {
+			return nil
+		}
+		return &data.Song{Title: "Amazing Grace", Author: "John Newton", CCLI: "22025", Copyright: "Public Domain"}
+	}
+
+	want := "Amazing Grace – John Newton · © Public Domain · CCLI Song #22025 · CCLI Licence #1234"
+	cfg := config.CCLI{Licence: "1234"}
+	for i, expected := range []string{"", want, "", want, ""} {
+		if got := footerOf(ss, i, cfg, songByID); got != expected {
+			t.Errorf("slide %d: got footer %q, want %q", i, got, expected)
+		}
+	}
+
+	cfg.Footer = footerEvery
+	if got := footerOf(ss, 2, cfg, songByID); got != want {
+		t.Errorf("every slide: got footer %q", got)
+	}
+	cfg.Footer = footerNone
+	if got := footerOf(ss, 1, cfg, songByID); got != "" {
+		t.Errorf("no footers: got footer %q", got)
+	}
+
+	// blank screens don't show it
+	p := Presentation{Index: 1, Text: "Amazing grace", Footer: want}
+	if c := p.Content(); c.Footer != want {
+		t.Errorf("bad content footer: %q", c.Footer)
+	}
+	p.Blank = true
+	if c := p.Content(); c.Footer != "" {
+		t.Errorf("blank content with footer: %q", c.Footer)
+	}
+}
+
+func TestShowFooter(t *testing.T) {
+	config.Config.CCLI = config.CCLI{Licence: "1234"}
+	defer func() { config.Config.CCLI = config.CCLI{} }()
+	song := data.Song{Title: "Amazing Grace", Author: "John Newton", CCLI: "22025", Content: "Amazing grace"}
+	if !song.Save() {
+		t.Fatal("could not save song")
+	}
+	deck := data.Deck{Title: "2022-06-19", Text: fmt.Sprintf("# Welcome\n\nGood morning\n\n# Amazing Grace (@%d)\nAmazing grace\n", song.RowID)}
+	if err := deck.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := data.SaveUser(data.User{ID: "ana", Name: "Ana"}, "ana's password"); err != nil {
+		t.Fatal(err)
+	}
+	session, err := data.NewSession(data.User{ID: "ana"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newServer()
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := inout.NewRequest(w, r)
+		req.Send(srv.Handle(req))
+	}))
+	defer hs.Close()
+	show := func(text string) Presentation {
+		t.Helper()
+		body := fmt.Sprintf(`{"title":"2022-06-19","show":%q}`, text)
+		r, _ := http.NewRequest(http.MethodPost, hs.URL+"/show", strings.NewReader(body))
+		r.Header.Set("Cookie", "session="+session)
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("showing %q: got %d", text, resp.StatusCode)
+		}
+		return srv.get("2022-06-19")
+	}
+
+	want := "Amazing Grace – John Newton · CCLI Song #22025 · CCLI Licence #1234"
+	if p := show("Amazing grace"); p.Index != 1 || p.Footer != want {
+		t.Errorf("bad presentation of a song's slide: %+v", p)
+	}
+	if p := show("Good morning"); p.Index != 0 || p.Footer != "" {
+		t.Errorf("bad presentation of a slide without a song: %+v", p)
+	}
+	if p := show("Amazing grace, how sweet"); p.Index != -1 || p.Footer != "" {
+		t.Errorf("bad presentation of free text: %+v", p)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Screens that don't take their messages for this long are dropped. It's
+// longer than writeWait, after which a stalled write fails anyway.
+const stuckTimeout = 3 * writeWait
+
+// slot keeps the latest message for a screen. Older slides are useless,
+// so a message that wasn't sent yet is replaced by newer ones, and
+// putting never blocks.
+type slot struct {
+	lock      sync.Mutex
+	msg       []byte
+	since     time.Time     // when the pending message was put
+	ready     chan struct{} // has a value while there's a message to take
+	coalesced int           // messages replaced before being sent
+	dropped   int           // messages never sent
+}
+
+func newSlot() *slot {
+	return &slot{ready: make(chan struct{}, 1)}
+}
+
+// put replaces the pending message, if any. It returns false if the
+// pending message was waiting for longer than stuckTimeout, in which case
+// the new one is dropped.
+func (s *slot) put(msg []byte, now time.Time) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.msg != nil {
+		if now.Sub(s.since) > stuckTimeout {
+			s.dropped++
+			return false
+		}
+		s.coalesced++
+	} else {
+		s.since = now
+	}
+	s.msg = msg
+
+	select {
+	case s.ready <- struct{}{}:
+	default: // already signalled
+	}
+	return true
+}
+
+// take returns the pending message, or nil
+func (s *slot) take() []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	msg := s.msg
+	s.msg = nil
+	return msg
+}
+
+// drop discards the pending message, when it can't be sent anymore
+func (s *slot) drop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.msg != nil {
+		s.dropped++
+		s.msg = nil
+	}
+}
+
+// discarded counts a message that couldn't be queued
+func (s *slot) discarded() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.dropped++
+}
+
+// counts returns how many messages were coalesced and dropped
+func (s *slot) counts() (coalesced, dropped int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.coalesced, s.dropped
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlot(t *testing.T) {
+	s := newSlot()
+	now := time.Now()
+	if msg := s.take(); msg != nil {
+		t.Errorf("expected nothing, got %q", msg)
+	}
+
+	// only the latest is kept
+	for i := 1; i <= 3; i++ {
+		if !s.put([]byte(fmt.Sprint(i)), now) {
+			t.Fatalf("put %d failed", i)
+		}
+	}
+	select {
+	case <-s.ready:
+	default:
+		t.Error("expected the slot to be ready")
+	}
+	if msg := s.take(); string(msg) != "3" {
+		t.Errorf("expected the latest message, got %q", msg)
+	}
+	if c, d := s.counts(); c != 2 || d != 0 {
+		t.Errorf("expected 2 coalesced and 0 dropped, got %d and %d", c, d)
+	}
+
+	// a message waiting for too long means the screen is stuck
+	s.put([]byte("4"), now)
+	if !s.put([]byte("5"), now.Add(stuckTimeout/2)) {
+		t.Error("screen shouldn't be stuck yet")
+	}
+	if s.put([]byte("6"), now.Add(stuckTimeout+time.Second)) {
+		t.Error("screen should be stuck")
+	}
+	s.drop()
+	if c, d := s.counts(); c != 3 || d != 2 {
+		t.Errorf("expected 3 coalesced and 2 dropped, got %d and %d", c, d)
+	}
+	if msg := s.take(); msg != nil {
+		t.Errorf("expected nothing after dropping, got %q", msg)
+	}
+}
+
+func TestBroadcastDoesNotBlock(t *testing.T) {
+	// screens without a writer never take their messages
+	srv := &Server{screens: map[string][]*Screen{}}
+	for i := 0; i < 3; i++ {
+		srv.screens["deck"] = append(srv.screens["deck"], &Screen{title: "deck", role: roleAudience, out: newSlot()})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			srv.Broadcast("deck", roleAudience, newContent(fmt.Sprint(i)))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("broadcast blocked")
+	}
+
+	for _, scr := range srv.screens["deck"] {
+		if c, _ := scr.out.counts(); c != 99 {
+			t.Errorf("expected 99 coalesced, got %d", c)
+		}
+		if msg := string(scr.out.take()); !strings.Contains(msg, `"text":"99"`) {
+			t.Errorf("expected the last content, got %q", msg)
+		}
+	}
+}
@@ -1,21 +1,33 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/paupin2/slides/cmd/slides/pkg/inout"
 	"github.com/paupin2/slides/cmd/slides/pkg/static"
 	"github.com/paupin2/slides/pkg/config"
 	"github.com/paupin2/slides/pkg/data"
+	"github.com/paupin2/slides/pkg/export"
 	"github.com/paupin2/slides/pkg/planningcenter"
+	"github.com/paupin2/slides/pkg/report"
 	"github.com/rs/zerolog/log"
 )
 
 var (
 	loadDecksPath = flag.String("load-decks", "", "Path where we should load decks from")
+	userName      = flag.String("user", "", "Username to set the password for")
+	fullName      = flag.String("name", "", "Full name of the user (optional)")
+	fullUpdate    = flag.Bool("full", false, "Update all songs, not only those changed since the last update")
+	deckTitle     = flag.String("title", "", "Title of the deck to export")
+	outputPath    = flag.String("output", "", "File to export to (default: the deck's title, or the report's period)")
+	pdfLayout     = flag.String("layout", export.LayoutSlides, "PDF layout: slides (one per page) or booklet")
+	reportFrom    = flag.String("from", "", "First day of the report, like 2022-01-01 (default: 6 months before -to)")
+	reportTo      = flag.String("to", "", "Last day of the report (default: today)")
 )
 
 func runServer() {
@@ -41,22 +53,132 @@ func runServer() {
 }
 
 func updateSongs() {
-	if err := planningcenter.Update(); err != nil {
+	if err := planningcenter.Update(*fullUpdate); err != nil {
 		log.Fatal().Err(err).Msg("update failed")
 	}
 	log.Info().Msg("update ok")
 }
 
+func importPlans() {
+	imported, err := planningcenter.ImportPlans()
+	if err != nil {
+		log.Fatal().Err(err).Msg("import failed")
+	}
+	log.Info().Int("plans", len(imported)).Msg("import ok")
+}
+
+func exportPDF() {
+	if *deckTitle == "" || !export.ValidLayout(*pdfLayout) {
+		usage()
+	}
+	deck, found := data.LoadDeck(*deckTitle)
+	if !found {
+		log.Fatal().Str("title", *deckTitle).Msg("deck not found")
+	}
+
+	path := *outputPath
+	if path == "" {
+		path = deck.Title + ".pdf"
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal().Err(err).Msg("creating file")
+	}
+	if err = export.PDF(f, deck, *pdfLayout); err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		log.Fatal().Err(err).Str("path", path).Msg("export failed")
+	}
+	log.Info().Str("path", path).Msg("exported")
+}
+
+func writeReport() {
+	if flag.Arg(1) != "ccli" {
+		usage()
+	}
+	from, to, err := report.Period(*reportFrom, *reportTo)
+	if err != nil {
+		log.Fatal().Err(err).Msg("bad period")
+	}
+
+	path := *outputPath
+	if path == "" {
+		path = "ccli-" + from.Format("2006-01-02") + "-" + to.Format("2006-01-02") + ".csv"
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal().Err(err).Msg("creating file")
+	}
+	if err = report.CCLI(f, data.SongCounts(from, to)); err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		log.Fatal().Err(err).Str("path", path).Msg("report failed")
+	}
+	log.Info().Str("path", path).Msg("exported")
+}
+
 func loadDecks() {
 	data.ImportDecks(*loadDecksPath)
 }
 
+func setPassword() {
+	if *userName == "" {
+		usage()
+	}
+
+	fmt.Fprintf(os.Stderr, "password for %s: ", *userName)
+	passwd, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && passwd == "" {
+		log.Fatal().Err(err).Msg("reading password")
+	}
+
+	user := data.User{ID: *userName, Name: *fullName}
+	if err := data.SaveUser(user, strings.TrimRight(passwd, "\r\n")); err != nil {
+		log.Fatal().Err(err).Msg("setting password")
+	}
+}
+
+func migrate() {
+	switch flag.Arg(1) {
+	case "status":
+		list, err := data.MigrationStatus()
+		if err != nil {
+			log.Fatal().Err(err).Msg("getting migrations")
+		}
+		for _, m := range list {
+			status := "pending"
+			if m.Applied != nil {
+				status = "applied " + m.Applied.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d %-20s %s\n", m.Version, m.Name, status)
+		}
+
+	case "up":
+		count, err := data.Migrate()
+		if err != nil {
+			log.Fatal().Err(err).Msg("migrating")
+		}
+		log.Info().Int("applied", count).Msg("migrated")
+
+	default:
+		usage()
+	}
+}
+
 func usage() {
 	fmt.Fprintf(os.Stderr, "Usage: %s [-option] <action>\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "  action is one of:\n")
 	fmt.Fprintf(os.Stderr, "  \trun: run the server\n")
-	fmt.Fprintf(os.Stderr, "  \tupdate: update the songs from planning center\n")
+	fmt.Fprintf(os.Stderr, "  \tupdate: update the songs changed on planning center (all of them with -full)\n")
+	fmt.Fprintf(os.Stderr, "  \timport-plans: create or update the decks of the upcoming planning center plans\n")
+	fmt.Fprintf(os.Stderr, "  \texport-pdf: export the deck set with -title as a PDF\n")
+	fmt.Fprintf(os.Stderr, "  \treport ccli: write the songs used from -from to -to as CSV, for CCLI\n")
 	fmt.Fprintf(os.Stderr, "  \tload: load the decks from files into the database\n")
+	fmt.Fprintf(os.Stderr, "  \tpasswd: create a user, or change its password (read from stdin)\n")
+	fmt.Fprintf(os.Stderr, "  \tmigrate status: show the database migrations\n")
+	fmt.Fprintf(os.Stderr, "  \tmigrate up: apply pending database migrations\n")
 	flag.PrintDefaults()
 	os.Exit(1)
 }
@@ -64,23 +186,39 @@ func usage() {
 func main() {
 	flag.Parse()
 	args := flag.Args()
-	if len(args) != 1 {
+	if len(args) == 0 {
 		usage()
 	}
 
 	var action func()
+	connect := data.Connect
+	wantArgs := 1
 	switch args[0] {
 	case "run":
 		action = runServer
 	case "update":
 		action = updateSongs
+	case "import-plans":
+		action = importPlans
+	case "export-pdf":
+		action = exportPDF
+	case "report":
+		action, wantArgs = writeReport, 2
 	case "load":
 		action = loadDecks
+	case "passwd":
+		action = setPassword
+	case "migrate":
+		// don't apply migrations before the action
+		action, connect, wantArgs = migrate, data.Open, 2
 	default:
 		usage()
 	}
+	if len(args) != wantArgs {
+		usage()
+	}
 
 	config.Load()
-	data.Connect()
+	connect()
 	action()
 }
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paupin2/slides/pkg/config"
+	"github.com/paupin2/slides/pkg/data"
+)
+
+// TestMain connects to a database shared by the tests, since the
+// connection is only opened once
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "slides-test")
+	if err != nil {
+		panic(err)
+	}
+	config.Config.Path.Db = filepath.Join(dir, "test.sqlite3")
+	data.Connect()
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
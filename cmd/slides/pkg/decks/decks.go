@@ -1,11 +1,17 @@
 package decks
 
 import (
+	"bytes"
+	"mime"
 	"net/http"
 	"time"
 
 	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/paupin2/slides/cmd/slides/pkg/users"
 	"github.com/paupin2/slides/pkg/data"
+	"github.com/paupin2/slides/pkg/export"
+	"github.com/paupin2/slides/pkg/planningcenter"
+	"github.com/paupin2/slides/pkg/slides"
 )
 
 func HandleList(req *inout.Request) *inout.Reply {
@@ -21,6 +27,7 @@ func HandleList(req *inout.Request) *inout.Reply {
 type DeckReply struct {
 	Title    string     `json:"title"`
 	Text     string     `json:"text"`
+	Revision int        `json:"revision"`
 	Created  *time.Time `json:"created,omitempty"`
 	Modified *time.Time `json:"modified,omitempty"`
 }
@@ -29,6 +36,7 @@ func formatDeck(in data.Deck) DeckReply {
 	return DeckReply{
 		Title:    in.Title,
 		Text:     in.Text,
+		Revision: in.Revision,
 		Created:  &in.Created,
 		Modified: &in.Modified,
 	}
@@ -42,14 +50,63 @@ func HandleGet(req *inout.Request) *inout.Reply {
 	}
 
 	if deck, found := data.LoadDeck(title); found {
-		return inout.JSON(formatDeck(deck))
+		return inout.JSON(formatDeck(deck)).ETag(deck.Revision)
 	}
 	return inout.Error(http.StatusNotFound, "not found")
 }
 
+// HandleSlides returns the deck's text, parsed into slides
+func HandleSlides(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	title := req.Str("title").Get()
+	if req.Failed() {
+		return nil
+	}
+
+	if deck, found := data.LoadDeck(title); found {
+		return inout.JSON(slides.Parse(deck.Text))
+	}
+	return inout.Error(http.StatusNotFound, "not found")
+}
+
+// HandleExportPDF returns the deck as a PDF, to be printed
+func HandleExportPDF(req *inout.Request) *inout.Reply {
+	title := req.Str("title").Get()
+	layout := req.Str("layout").Def(export.LayoutSlides).Get()
+	if req.Failed() {
+		return nil
+	} else if !export.ValidLayout(layout) {
+		return inout.Error(http.StatusBadRequest, "bad layout")
+	}
+
+	deck, found := data.LoadDeck(title)
+	if !found {
+		return inout.Error(http.StatusNotFound, "not found")
+	}
+
+	var buf bytes.Buffer
+	if err := export.PDF(&buf, deck, layout); err != nil {
+		return inout.Error(http.StatusInternalServerError, "error exporting: %v", err)
+	}
+	reply := inout.Static("application/pdf", buf.Bytes())
+	reply.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{
+		"filename": deck.Title + ".pdf",
+	}))
+	return reply
+}
+
+// deckInput is a deck being saved. Revision is the one it was loaded at,
+// unless sent on If-Match.
+type deckInput struct {
+	DeckReply
+	Revision *int `json:"revision"`
+}
+
+// HandlePut saves the deck, if it wasn't changed since it was loaded.
+// Otherwise it replies with a conflict, and the current deck.
 func HandlePut(req *inout.Request) *inout.Reply {
 	req.IsAjax()
-	var dr DeckReply
+	var dr deckInput
 	if err := req.Read(&dr); err != nil {
 		return inout.Error(http.StatusBadRequest, "could not read data")
 	}
@@ -57,18 +114,28 @@ func HandlePut(req *inout.Request) *inout.Reply {
 	if err := data.CheckTitle(dr.Title); err != nil {
 		return inout.Error(http.StatusBadRequest, "bad title")
 	}
+	revision, found := req.IfMatch(dr.Revision)
+	if !found {
+		return inout.Error(http.StatusPreconditionRequired, "revision required")
+	}
 
+	user, _ := users.Current(req)
 	deck, found := data.LoadDeck(dr.Title)
 	if !found {
 		deck.Title = dr.Title
+		deck.Creator = user
 	}
 	deck.Text = dr.Text
+	deck.LastMod = user
 
-	if err := deck.Save(); err != nil {
+	if err := deck.SaveIf(revision); err == data.ErrConflict {
+		current, _ := data.LoadDeck(dr.Title)
+		return inout.Conflict(formatDeck(current), current.Revision)
+	} else if err != nil {
 		return inout.Error(http.StatusBadRequest, "error: %v", err)
 	}
 
-	return inout.OK()
+	return inout.JSON(formatDeck(deck)).ETag(deck.Revision)
 }
 
 func HandleDelete(req *inout.Request) *inout.Reply {
@@ -88,3 +155,17 @@ func HandleDelete(req *inout.Request) *inout.Reply {
 
 	return inout.OK()
 }
+
+// HandleImportPlans creates or updates the decks of the upcoming plans on
+// Planning Center
+func HandleImportPlans(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	imported, err := planningcenter.ImportPlans()
+	if err != nil {
+		return inout.Error(http.StatusBadGateway, "error importing plans: %v", err)
+	}
+	if imported == nil {
+		imported = []planningcenter.PlanImport{}
+	}
+	return inout.JSON(imported)
+}
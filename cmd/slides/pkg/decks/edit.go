@@ -0,0 +1,393 @@
+package decks
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/paupin2/slides/cmd/slides/pkg/users"
+	"github.com/paupin2/slides/pkg/data"
+	"github.com/paupin2/slides/pkg/ot"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// SaveDelay is how long after the last change the deck is saved
+	SaveDelay = 2 * time.Second
+
+	editWriteWait  = 10 * time.Second
+	editPongWait   = 60 * time.Second
+	editPingPeriod = 50 * time.Second
+	maxEditMessage = 1 << 20
+)
+
+// edit message types
+const (
+	editInit    = "init"    // server: the text and its revision, on connecting
+	editOp      = "op"      // both: an operation on the text
+	editAck     = "ack"     // server: the editor's operation was applied
+	editSel     = "sel"     // editor: where its cursor is
+	editEditors = "editors" // server: who is editing, and where
+	editSave    = "save"    // editor: save now
+	editSaved   = "saved"   // server: the deck was saved
+	editError   = "error"   // server: something went wrong
+)
+
+// Selection is the start and end of an editor's selection, in UTF-16
+// code units
+type Selection [2]int
+
+// EditMessage is exchanged with the editors of a deck. `Rev` is the number
+// of operations the text went through since the session started.
+type EditMessage struct {
+	Type     string        `json:"type"`
+	Rev      int           `json:"rev"`
+	Op       *ot.Operation `json:"op,omitempty"`
+	Sel      *Selection    `json:"sel,omitempty"`
+	Text     *string       `json:"text,omitempty"`
+	Revision int           `json:"revision,omitempty"` // of the saved deck
+	You      int           `json:"you,omitempty"`      // the editor's id
+	From     int           `json:"from,omitempty"`     // who sent the operation
+	Editors  []EditorInfo  `json:"editors,omitempty"`
+	Message  string        `json:"message,omitempty"`
+}
+
+// EditorInfo describes someone editing a deck
+type EditorInfo struct {
+	ID   int       `json:"id"`
+	Name string    `json:"name"`
+	Sel  Selection `json:"sel"`
+}
+
+type editor struct {
+	id   int
+	user data.User
+	conn *websocket.Conn
+	out  chan []byte
+	done chan struct{} // closed when reading fails
+	sel  Selection
+}
+
+// send queues the message; editors that can't keep up are disconnected,
+// and get the whole text again when reconnecting
+func (e *editor) send(m EditMessage) {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	select {
+	case e.out <- buf:
+	default:
+		e.conn.Close()
+	}
+}
+
+// session is the deck being edited. It has the authoritative text, which
+// every operation is transformed against and applied to.
+type session struct {
+	lock    sync.Mutex
+	deck    data.Deck
+	base    string // the text as saved, at the deck's revision
+	text    string
+	history []ot.Operation // rev is len(history)
+	editors map[int]*editor
+	dirty   bool
+	lastMod data.User // who made the last change
+	timer   *time.Timer
+}
+
+var (
+	sessionsLock sync.Mutex
+	sessions     = map[string]*session{}
+	lastEditorID int
+)
+
+// join adds the editor to the deck's session, starting it if needed
+func join(title string, e *editor) *session {
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+	lastEditorID++
+	e.id = lastEditorID
+
+	s := sessions[title]
+	if s == nil {
+		deck, found := data.LoadDeck(title)
+		if !found {
+			deck = data.Deck{Title: title, Creator: e.user}
+		}
+		s = &session{deck: deck, base: deck.Text, text: deck.Text, editors: map[int]*editor{}}
+		sessions[title] = s
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.editors[e.id] = e
+	text := s.text
+	e.send(EditMessage{Type: editInit, Rev: len(s.history), Text: &text, Revision: s.deck.Revision, You: e.id})
+	s.sendEditors()
+	return s
+}
+
+// leave removes the editor; the last one to leave saves the deck, and
+// ends the session
+func (s *session) leave(e *editor) {
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.editors, e.id)
+	if len(s.editors) > 0 {
+		s.sendEditors()
+		return
+	}
+	s.save()
+	if sessions[s.deck.Title] == s {
+		delete(sessions, s.deck.Title)
+	}
+}
+
+// apply transforms the operation, made on revision `rev`, against the
+// ones since, and applies it
+func (s *session) apply(e *editor, rev int, op ot.Operation, sel *Selection) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if rev < 0 || rev > len(s.history) {
+		e.send(EditMessage{Type: editError, Message: "bad revision"})
+		return
+	}
+
+	var err error
+	for _, other := range s.history[rev:] {
+		if op, _, err = ot.Transform(op, other); err != nil {
+			break
+		}
+	}
+	text := s.text
+	if err == nil {
+		text, err = op.Apply(s.text)
+	}
+	if err != nil {
+		e.send(EditMessage{Type: editError, Message: err.Error()})
+		e.conn.Close() // it'll get the whole text when reconnecting
+		return
+	}
+
+	s.text = text
+	s.history = append(s.history, op)
+	s.dirty, s.lastMod = true, e.user
+	for _, other := range s.editors {
+		if other == e {
+			continue
+		}
+		other.sel = Selection{ot.TransformIndex(other.sel[0], op, false), ot.TransformIndex(other.sel[1], op, false)}
+		other.send(EditMessage{Type: editOp, Rev: len(s.history), Op: &op, From: e.id})
+	}
+	if sel != nil {
+		e.sel = *sel
+	} else {
+		e.sel = Selection{ot.TransformIndex(e.sel[0], op, true), ot.TransformIndex(e.sel[1], op, true)}
+	}
+	e.send(EditMessage{Type: editAck, Rev: len(s.history)})
+	s.sendEditors()
+
+	// save once the editors pause
+	if s.timer == nil {
+		s.timer = time.AfterFunc(SaveDelay, func() {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			s.save()
+		})
+	} else {
+		s.timer.Reset(SaveDelay)
+	}
+}
+
+// selected updates where the editor's cursor is
+func (s *session) selected(e *editor, sel Selection) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e.sel = sel
+	s.sendEditors()
+}
+
+// save stores the text, if it changed. The lock must be held.
+func (s *session) save() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if !s.dirty {
+		return
+	}
+
+	s.deck.Text = s.text
+	s.deck.LastMod = s.lastMod
+	err := s.deck.SaveIf(s.deck.Revision)
+	for tries := 0; err == data.ErrConflict && tries < 3; tries++ {
+		// saved elsewhere meanwhile: merge those changes, and try again
+		if err = s.merge(); err == nil {
+			s.deck.Text = s.text
+			err = s.deck.SaveIf(s.deck.Revision)
+		}
+	}
+	if err != nil {
+		log.Error().Err(err).Str("title", s.deck.Title).Msg("saving edited deck")
+		for _, e := range s.editors {
+			e.send(EditMessage{Type: editError, Message: "could not save"})
+		}
+		return
+	}
+	s.dirty = false
+	s.base = s.text
+	for _, e := range s.editors {
+		e.send(EditMessage{Type: editSaved, Rev: len(s.history), Revision: s.deck.Revision})
+	}
+}
+
+// merge applies the changes made to the deck elsewhere since it was last
+// saved here, as an operation of its own that every editor gets. The lock
+// must be held.
+func (s *session) merge() error {
+	current, found := data.LoadDeck(s.deck.Title)
+	if !found {
+		// deleted meanwhile: save it again
+		s.deck.Revision = 0
+		return nil
+	}
+	log.Warn().Str("title", s.deck.Title).Int("revision", current.Revision).Msg("merging deck saved elsewhere")
+
+	ours, theirs := ot.Diff(s.base, s.text), ot.Diff(s.base, current.Text)
+	_, op, err := ot.Transform(ours, theirs)
+	if err != nil {
+		return err
+	}
+	text, err := op.Apply(s.text)
+	if err != nil {
+		return err
+	}
+
+	s.deck.Revision = current.Revision
+	s.base = current.Text
+	if op.IsNoop() {
+		return nil
+	}
+	s.text = text
+	s.history = append(s.history, op)
+	for _, e := range s.editors {
+		e.sel = Selection{ot.TransformIndex(e.sel[0], op, false), ot.TransformIndex(e.sel[1], op, false)}
+		e.send(EditMessage{Type: editOp, Rev: len(s.history), Op: &op})
+		e.send(EditMessage{Type: editError, Message: "the deck was saved elsewhere meanwhile; those changes were merged"})
+	}
+	s.sendEditors()
+	return nil
+}
+
+// sendEditors tells every editor who is editing. The lock must be held.
+func (s *session) sendEditors() {
+	list := make([]EditorInfo, 0, len(s.editors))
+	for _, e := range s.editors {
+		list = append(list, EditorInfo{ID: e.id, Name: e.user.Name, Sel: e.sel})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	for _, e := range s.editors {
+		e.send(EditMessage{Type: editEditors, Editors: list})
+	}
+}
+
+// HandleEdit edits the deck together with everyone else editing it,
+// through a websocket. The server keeps the text: editors send it their
+// operations, which are transformed against the others', and saved once
+// everyone pauses.
+func HandleEdit(req *inout.Request) *inout.Reply {
+	title := req.Str("title").Get()
+	if req.Failed() {
+		return inout.Error(http.StatusBadRequest, "bad title")
+	}
+	if err := data.CheckTitle(title); err != nil {
+		return inout.Error(http.StatusBadRequest, "bad title")
+	}
+	user, _ := users.Current(req)
+
+	conn, err := req.Upgrade()
+	if err != nil {
+		log.Error().Err(err).Msg("upgrading socket")
+		return inout.Error(http.StatusInternalServerError, "error connecting")
+	}
+
+	e := &editor{user: user, conn: conn, out: make(chan []byte, 256), done: make(chan struct{})}
+	s := join(title, e)
+	go e.writer()
+	go func() {
+		defer func() {
+			close(e.done)
+			s.leave(e)
+		}()
+		e.reader(s)
+	}()
+	return inout.Handled()
+}
+
+// reader handles the editor's messages, until the connection fails
+func (e *editor) reader(s *session) {
+	e.conn.SetReadLimit(maxEditMessage)
+	_ = e.conn.SetReadDeadline(time.Now().Add(editPongWait))
+	e.conn.SetPongHandler(func(string) error {
+		return e.conn.SetReadDeadline(time.Now().Add(editPongWait))
+	})
+
+	for {
+		var m EditMessage
+		if err := e.conn.ReadJSON(&m); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Debug().Err(err).Str("title", s.deck.Title).Msg("reading edits")
+			}
+			return
+		}
+		_ = e.conn.SetReadDeadline(time.Now().Add(editPongWait))
+
+		switch {
+		case m.Type == editOp && m.Op != nil:
+			s.apply(e, m.Rev, *m.Op, m.Sel)
+		case m.Type == editSel && m.Sel != nil:
+			s.selected(e, *m.Sel)
+		case m.Type == editSave:
+			s.lock.Lock()
+			s.save()
+			s.lock.Unlock()
+		default:
+			e.send(EditMessage{Type: editError, Message: "bad message"})
+		}
+	}
+}
+
+// writer sends the queued messages, and pings, until the connection fails
+func (e *editor) writer() {
+	ticker := time.NewTicker(editPingPeriod)
+	defer func() {
+		ticker.Stop()
+		e.conn.Close()
+	}()
+
+	for {
+		var (
+			msg []byte
+			typ = websocket.TextMessage
+		)
+		select {
+		case msg = <-e.out:
+		case <-ticker.C:
+			typ = websocket.PingMessage
+		case <-e.done:
+			return
+		}
+		_ = e.conn.SetWriteDeadline(time.Now().Add(editWriteWait))
+		if err := e.conn.WriteMessage(typ, msg); err != nil {
+			return
+		}
+	}
+}
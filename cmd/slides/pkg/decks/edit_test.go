@@ -0,0 +1,168 @@
+package decks
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/paupin2/slides/pkg/config"
+	"github.com/paupin2/slides/pkg/data"
+	"github.com/paupin2/slides/pkg/ot"
+)
+
+// next returns the next message of the type, skipping others
+func next(t *testing.T, conn *websocket.Conn, typ string) EditMessage {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var m EditMessage
+		if err := conn.ReadJSON(&m); err != nil {
+			t.Fatalf("waiting for %s: %v", typ, err)
+		}
+		if m.Type == typ {
+			return m
+		}
+	}
+}
+
+func send(t *testing.T, conn *websocket.Conn, rev int, op string) {
+	t.Helper()
+	var o ot.Operation
+	if err := json.Unmarshal([]byte(op), &o); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteJSON(EditMessage{Type: editOp, Rev: rev, Op: &o}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	config.Config.Path.Db = filepath.Join(t.TempDir(), "test.sqlite3")
+	data.Connect()
+	deck := data.Deck{Title: "2022-06-05", Text: "hello"}
+	if err := deck.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := inout.NewRequest(w, r)
+		req.Send(HandleEdit(req))
+	}))
+	defer hs.Close()
+	dial := func() *websocket.Conn {
+		url := "ws" + strings.TrimPrefix(hs.URL, "http") + "/deck/edit?title=2022-06-05"
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	a := dial()
+	defer a.Close()
+	if m := next(t, a, editInit); m.Text == nil || *m.Text != "hello" || m.Rev != 0 || m.Revision != 1 {
+		t.Fatalf("bad init: %+v", m)
+	}
+	b := dial()
+	defer b.Close()
+	next(t, b, editInit)
+	if m := next(t, a, editEditors); len(m.Editors) != 1 {
+		t.Errorf("expected only a editing, got %+v", m.Editors)
+	} else if m = next(t, a, editEditors); len(m.Editors) != 2 {
+		t.Errorf("expected 2 editors, got %+v", m.Editors)
+	}
+
+	// a changes revision 0, and then b changes it too, before getting a's change
+	send(t, a, 0, `[5," world"]`)
+	if m := next(t, a, editAck); m.Rev != 1 {
+		t.Errorf("expected a's change to be revision 1, got %d", m.Rev)
+	}
+	send(t, b, 0, `["oh, ",5]`)
+
+	// b transforms a's change against its own, like editors do
+	var own ot.Operation
+	_ = json.Unmarshal([]byte(`["oh, ",5]`), &own)
+	m := next(t, b, editOp)
+	_, op, err := ot.Transform(own, *m.Op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	textB, err := op.Apply("oh, hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := next(t, b, editAck); m.Rev != 2 {
+		t.Errorf("expected b's change to be revision 2, got %d", m.Rev)
+	}
+
+	// a gets b's change, already transformed by the server
+	m = next(t, a, editOp)
+	textA, err := m.Op.Apply("hello world")
+	if err != nil {
+		t.Fatalf("applying %s: %v", mustJSON(m.Op), err)
+	}
+	if textA != "oh, hello world" || textB != textA {
+		t.Errorf("editors diverged: %q and %q", textA, textB)
+	}
+
+	// saved once everyone pauses, or when asked to
+	if err := a.WriteJSON(EditMessage{Type: editSave}); err != nil {
+		t.Fatal(err)
+	}
+	if m := next(t, b, editSaved); m.Revision != 2 {
+		t.Errorf("expected revision 2, got %+v", m)
+	}
+	if saved, _ := data.LoadDeck("2022-06-05"); saved.Text != "oh, hello world" {
+		t.Errorf("bad saved text %q", saved.Text)
+	}
+
+	// saved elsewhere meanwhile: those changes are merged with the editors'
+	elsewhere := data.Deck{Title: "2022-06-05", Text: "Oh, hello world"}
+	if err := elsewhere.SaveIf(2); err != nil {
+		t.Fatal(err)
+	}
+	send(t, a, 2, `[15,"!"]`)
+	next(t, a, editAck)
+	if m := next(t, b, editOp); m.Rev != 3 {
+		t.Errorf("expected a's change to be revision 3, got %d", m.Rev)
+	}
+	if err := a.WriteJSON(EditMessage{Type: editSave}); err != nil {
+		t.Fatal(err)
+	}
+	for _, conn := range []*websocket.Conn{a, b} {
+		m := next(t, conn, editOp)
+		if text, err := m.Op.Apply("oh, hello world!"); err != nil || text != "Oh, hello world!" || m.Rev != 4 {
+			t.Errorf("bad merge %s at %d: %q, %v", mustJSON(m.Op), m.Rev, text, err)
+		}
+		if m := next(t, conn, editSaved); m.Revision != 4 || m.Rev != 4 {
+			t.Errorf("expected revision 4, got %+v", m)
+		}
+	}
+	if saved, _ := data.LoadDeck("2022-06-05"); saved.Text != "Oh, hello world!" || saved.Revision != 4 {
+		t.Errorf("bad merged deck: %+v", saved)
+	}
+
+	// and go on editing it
+	send(t, b, 4, `[16,"?"]`)
+	next(t, b, editAck)
+	if err := b.WriteJSON(EditMessage{Type: editSave}); err != nil {
+		t.Fatal(err)
+	}
+	if m := next(t, a, editSaved); m.Revision != 5 {
+		t.Errorf("expected revision 5, got %+v", m)
+	}
+	if saved, _ := data.LoadDeck("2022-06-05"); saved.Text != "Oh, hello world!?" {
+		t.Errorf("bad saved text %q", saved.Text)
+	}
+}
+
+func mustJSON(v any) string {
+	buf, _ := json.Marshal(v)
+	return string(buf)
+}
@@ -0,0 +1,104 @@
+package decks
+
+import (
+	"net/http"
+
+	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/paupin2/slides/cmd/slides/pkg/users"
+	"github.com/paupin2/slides/pkg/data"
+	"github.com/paupin2/slides/pkg/diff"
+)
+
+// HandleRevisions lists the deck's revisions, newest first
+func HandleRevisions(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	title := req.Str("title").Get()
+	if req.Failed() {
+		return nil
+	}
+
+	list := data.DeckRevisions(title)
+	if len(list) == 0 {
+		return inout.Error(http.StatusNotFound, "not found")
+	}
+	return inout.JSON(list)
+}
+
+// HandleRevision returns a revision of the deck
+func HandleRevision(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	title := req.Str("title").Get()
+	revision := req.Int("revision").Get()
+	if req.Failed() {
+		return nil
+	}
+
+	if rev, found := data.LoadDeckRevision(title, revision); found {
+		return inout.JSON(rev)
+	}
+	return inout.Error(http.StatusNotFound, "not found")
+}
+
+type DiffReply struct {
+	From  int         `json:"from"`
+	To    int         `json:"to"`
+	Lines []diff.Line `json:"lines"`
+}
+
+// HandleDiff compares two revisions of the deck, line by line. If `to` is
+// omitted, `from` is compared to the current revision.
+func HandleDiff(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	title := req.Str("title").Get()
+	from := req.Int("from").Get()
+	to := req.Int("to").Def(0).Get()
+	if req.Failed() {
+		return nil
+	}
+
+	if to == 0 {
+		deck, found := data.LoadDeck(title)
+		if !found {
+			return inout.Error(http.StatusNotFound, "not found")
+		}
+		to = deck.Revision
+	}
+
+	a, foundA := data.LoadDeckRevision(title, from)
+	b, foundB := data.LoadDeckRevision(title, to)
+	if !foundA || !foundB {
+		return inout.Error(http.StatusNotFound, "not found")
+	}
+
+	return inout.JSON(DiffReply{From: from, To: to, Lines: diff.Lines(a.Text, b.Text)})
+}
+
+// HandleRestore saves an old revision's text as a new revision
+func HandleRestore(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	title := req.Str("title").Get()
+	revision := req.Int("revision").Get()
+	if req.Failed() {
+		return nil
+	}
+
+	rev, found := data.LoadDeckRevision(title, revision)
+	if !found {
+		return inout.Error(http.StatusNotFound, "not found")
+	}
+
+	user, _ := users.Current(req)
+	deck, found := data.LoadDeck(rev.Title)
+	if !found {
+		// restoring a deleted deck
+		deck.Title = rev.Title
+		deck.Creator = user
+	}
+	deck.Text = rev.Text
+	deck.LastMod = user
+
+	if err := deck.Save(); err != nil {
+		return inout.Error(http.StatusInternalServerError, "error: %v", err)
+	}
+	return inout.JSON(formatDeck(deck))
+}
@@ -0,0 +1,71 @@
+package inout
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Events streams server-sent events to the client
+type Events struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	done    <-chan struct{}
+}
+
+// Events starts streaming server-sent events. The response is sent by
+// then, so the handler must return Handled.
+func (req *Request) Events() (*Events, error) {
+	flusher, ok := req.w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming not supported")
+	}
+
+	h := req.w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no") // don't let proxies buffer events
+	req.w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &Events{w: req.w, flusher: flusher, done: req.r.Context().Done()}, nil
+}
+
+// Done is closed when the client goes away
+func (ev *Events) Done() <-chan struct{} {
+	return ev.done
+}
+
+// Retry tells the client how long to wait before reconnecting
+func (ev *Events) Retry(ms int) error {
+	return ev.write(fmt.Sprintf("retry: %d\n\n", ms))
+}
+
+// Send sends a message event. Clients send back the id of the last event
+// they got as Last-Event-ID, when reconnecting.
+func (ev *Events) Send(id string, data []byte) error {
+	var buf bytes.Buffer
+	if id != "" {
+		fmt.Fprintf(&buf, "id: %s\n", id)
+	}
+	for _, line := range bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	return ev.write(buf.String())
+}
+
+// Comment sends a comment, ignored by clients, to keep the connection open
+func (ev *Events) Comment(text string) error {
+	return ev.write(": " + text + "\n\n")
+}
+
+func (ev *Events) write(s string) error {
+	if _, err := ev.w.Write([]byte(s)); err != nil {
+		return err
+	}
+	ev.flusher.Flush()
+	return nil
+}
@@ -9,6 +9,7 @@ type Reply struct {
 	Status  int
 	Bytes   []byte
 	headers http.Header
+	handled bool // the response was already sent
 }
 
 func (r *Reply) Header(key, value string, args ...any) {
@@ -21,6 +22,14 @@ func (r *Reply) Header(key, value string, args ...any) {
 	r.headers.Set(key, value)
 }
 
+// SetCookie adds a cookie to the reply
+func (r *Reply) SetCookie(c *http.Cookie) {
+	if r.headers == nil {
+		r.headers = http.Header{}
+	}
+	r.headers.Add("Set-Cookie", c.String())
+}
+
 func Status(code int) *Reply {
 	return &Reply{
 		Status: code,
@@ -59,6 +68,25 @@ func JSON(data any) *Reply {
 	return ajax.Reply()
 }
 
+// ETag sets the reply's entity tag to the revision
+func (r *Reply) ETag(revision int) *Reply {
+	r.Header("ETag", `"%d"`, revision)
+	return r
+}
+
+// Conflict replies that the data was changed since the client loaded it,
+// with its current version
+func Conflict(current any, revision int) *Reply {
+	ajax := &Ajax{Status: http.StatusConflict, Error: "changed since it was loaded", Data: current}
+	return ajax.Reply().ETag(revision)
+}
+
+// Handled is returned by handlers that already sent the response
+// themselves, like when streaming events or upgrading to a websocket
+func Handled() *Reply {
+	return &Reply{handled: true}
+}
+
 func OK() *Reply {
 	return Ajax{OK: true}.Reply()
 }
@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 
 	"github.com/gorilla/websocket"
+	"github.com/paupin2/slides/pkg/config"
 	"github.com/rs/zerolog/log"
 )
 
@@ -60,6 +62,80 @@ func (req *Request) Read(d any) error {
 	return json.NewDecoder(req.r.Body).Decode(d)
 }
 
+// RemoteAddr returns the client's address. X-Forwarded-For is only used
+// when the request comes from a trusted proxy, and then the address is the
+// last one on it that isn't also a trusted proxy.
+func (req *Request) RemoteAddr() string {
+	addr := req.r.RemoteAddr
+	if !trustedProxy(addr) {
+		return addr
+	}
+
+	hops := strings.Split(req.r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			break
+		}
+		addr = hop
+		if !trustedProxy(hop) {
+			break
+		}
+	}
+	return addr
+}
+
+// trustedProxy returns true if the address (with or without a port) is one
+// of the configured trusted proxies, given as addresses or CIDR ranges
+func trustedProxy(addr string) bool {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, proxy := range config.Config.TrustedProxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if ip.Equal(net.ParseIP(proxy)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Header returns the value of the request header
+func (req *Request) Header(name string) string {
+	return req.r.Header.Get(name)
+}
+
+// IfMatch returns the revision the request expects to change: the one on
+// the If-Match header, or else the one given. It returns false if there's
+// neither.
+func (req *Request) IfMatch(revision *int) (int, bool) {
+	if tag := req.r.Header.Get("If-Match"); tag != "" {
+		tag = strings.Trim(strings.TrimPrefix(tag, "W/"), `"`)
+		n, err := strconv.Atoi(tag)
+		return n, err == nil
+	}
+	if revision != nil {
+		return *revision, true
+	}
+	return 0, false
+}
+
+// Cookie returns the value of the cookie, or an empty string
+func (req *Request) Cookie(name string) string {
+	if c, err := req.r.Cookie(name); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
 func (req *Request) IsAjax() {
 	req.forceJSON = true
 }
@@ -84,14 +160,24 @@ func (req *Request) Error(format string, a ...any) {
 }
 
 func (req *Request) Send(reply *Reply) {
-	if req.status == 0 {
-		// default status to OK
-		req.status = http.StatusOK
-	}
-
 	if reply == nil {
 		reply = &Reply{Status: http.StatusOK}
 	}
+	if reply.handled {
+		log.Info().
+			Str("method", req.r.Method).
+			Str("path", req.r.URL.Path).
+			Msg("request handled")
+		return
+	}
+
+	if req.status == 0 {
+		// default status to the reply's, or OK
+		req.status = reply.Status
+		if req.status == 0 {
+			req.status = http.StatusOK
+		}
+	}
 
 	if req.Failed() {
 		// previous errors take precedence over reply
@@ -0,0 +1,32 @@
+package reports
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+
+	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/paupin2/slides/pkg/data"
+	"github.com/paupin2/slides/pkg/report"
+)
+
+// HandleCCLI returns the songs used on the decks from `from` to `to`, as
+// CSV to report to CCLI
+func HandleCCLI(req *inout.Request) *inout.Reply {
+	from, to, err := report.Period(req.Str("from").Def("").Get(), req.Str("to").Def("").Get())
+	if req.Failed() {
+		return nil
+	} else if err != nil {
+		return inout.Error(http.StatusBadRequest, err.Error())
+	}
+
+	var buf bytes.Buffer
+	if err := report.CCLI(&buf, data.SongCounts(from, to)); err != nil {
+		return inout.Error(http.StatusInternalServerError, "error exporting: %v", err)
+	}
+	reply := inout.Static("text/csv; charset=utf-8", buf.Bytes())
+	reply.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": "ccli-" + from.Format("2006-01-02") + "-" + to.Format("2006-01-02") + ".csv",
+	}))
+	return reply
+}
@@ -0,0 +1,90 @@
+package songs
+
+import (
+	"net/http"
+
+	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/paupin2/slides/pkg/data"
+)
+
+// HandleArrangements returns the song's arrangements
+func HandleArrangements(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	id := req.Int("song_id").Get()
+	if req.Failed() {
+		return nil
+	}
+
+	if data.SongByID(id) == nil {
+		return inout.Error(http.StatusNotFound, "not found")
+	}
+	return inout.JSON(data.SongArrangements(id))
+}
+
+// saveArrangement checks and saves the arrangement, replying with it
+func saveArrangement(a *data.Arrangement) *inout.Reply {
+	if err := a.Check(); err != nil {
+		return inout.Error(http.StatusBadRequest, "bad data")
+	}
+
+	switch err := a.Save(); err {
+	case nil:
+		return inout.JSON(a)
+	case data.ErrNotFound:
+		return inout.Error(http.StatusNotFound, "not found")
+	default:
+		return inout.Error(http.StatusInternalServerError, "error saving")
+	}
+}
+
+// HandleArrangementPost adds an arrangement to a song
+func HandleArrangementPost(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	var input data.Arrangement
+	if err := req.Read(&input); err != nil {
+		return inout.Error(http.StatusBadRequest, "bad input")
+	}
+
+	if input.ID != 0 {
+		return inout.Error(http.StatusBadRequest, "unexpected id")
+	}
+	return saveArrangement(&input)
+}
+
+// HandleArrangementPut updates an arrangement; its song can't be changed
+func HandleArrangementPut(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	var input data.Arrangement
+	if err := req.Read(&input); err != nil {
+		return inout.Error(http.StatusBadRequest, "bad input")
+	}
+
+	a := data.ArrangementByID(input.ID)
+	if a == nil {
+		return inout.Error(http.StatusNotFound, "not found")
+	}
+	a.Name = input.Name
+	a.Key = input.Key
+	a.Tempo = input.Tempo
+	a.Sequence = input.Sequence
+	a.Content = input.Content
+	return saveArrangement(a)
+}
+
+// HandleArrangementDelete removes an arrangement
+func HandleArrangementDelete(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	id := req.Int("arrangement_id").Get()
+	if req.Failed() {
+		return nil
+	}
+
+	a := data.ArrangementByID(id)
+	if a == nil {
+		return inout.Error(http.StatusNotFound, "not found")
+	}
+	if err := a.Delete(); err != nil {
+		return inout.Error(http.StatusInternalServerError, "could not delete")
+	}
+	return inout.OK()
+}
@@ -1,10 +1,13 @@
 package songs
 
 import (
+	"html"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/paupin2/slides/cmd/slides/pkg/users"
 	"github.com/paupin2/slides/pkg/data"
 )
 
@@ -16,6 +19,18 @@ type ListItem struct {
 	Imported bool      `json:"imported,omitempty"`
 	Text     string    `json:"text,omitempty"`
 	Modified time.Time `json:"modified,omitempty"`
+	Revision int       `json:"revision,omitempty"`
+	LastUsed string    `json:"last_used,omitempty"` // the last day it was used on
+	Markup   string    `json:"markup,omitempty"`    // HTML title, with the search highlighted
+	Snippet  string    `json:"snippet,omitempty"`   // HTML lyrics, with the search highlighted
+
+	Copyright       string     `json:"copyright,omitempty"`
+	Themes          string     `json:"themes,omitempty"` // comma-separated
+	Admin           string     `json:"admin,omitempty"`
+	Notes           string     `json:"notes,omitempty"`
+	Key             string     `json:"key,omitempty"`
+	Tempo           int        `json:"tempo,omitempty"`             // beats per minute
+	LastScheduledAt *time.Time `json:"last_scheduled_at,omitempty"` // on planning center; read-only
 }
 
 func (li *ListItem) Song() (song *data.Song) {
@@ -30,48 +45,91 @@ func (li *ListItem) Song() (song *data.Song) {
 		song.Author = li.Author
 		song.CCLI = li.CCLI
 		song.Content = li.Text
+		song.Copyright = li.Copyright
+		song.Themes = li.Themes
+		song.Admin = li.Admin
+		song.Notes = li.Notes
+		song.Key = li.Key
+		song.Tempo = li.Tempo
 	}
 	return song
 }
 
 func newListItem(s *data.Song) ListItem {
-	return ListItem{
-		ID:       s.RowID,
-		Title:    s.Title,
-		Author:   s.Author,
-		CCLI:     s.CCLI,
-		Imported: s.ExternalID != "",
-		Modified: s.Modified,
-		Text:     s.Content,
-	}
+	li := ListItem{
+		ID:        s.RowID,
+		Title:     s.Title,
+		Author:    s.Author,
+		CCLI:      s.CCLI,
+		Imported:  s.ExternalID != "",
+		Modified:  s.Modified,
+		Revision:  s.Revision,
+		Text:      s.Content,
+		Copyright: s.Copyright,
+		Themes:    s.Themes,
+		Admin:     s.Admin,
+		Notes:     s.Notes,
+		Key:       s.Key,
+		Tempo:     s.Tempo,
+	}
+	if !s.LastScheduledAt.IsZero() {
+		li.LastScheduledAt = &s.LastScheduledAt
+	}
+	return li
 }
 
 const (
 	searchLimit = 25
 )
 
+// HandleList returns the songs with the name (or the words on their lyrics,
+// author or CCLI number), and matching the filters: theme, key, copyright,
+// min_tempo and max_tempo
 func HandleList(req *inout.Request) *inout.Reply {
 	req.IsAjax()
 	name := req.Str("name").Def("").Get()
+	filter := data.SongFilter{
+		Theme:     req.Str("theme").Def("").Get(),
+		Key:       req.Str("key").Def("").Get(),
+		Copyright: req.Str("copyright").Def("").Get(),
+		MinTempo:  req.Int("min_tempo").Def(0).Get(),
+		MaxTempo:  req.Int("max_tempo").Def(0).Get(),
+	}
 	if req.Failed() {
 		return inout.Status(http.StatusBadRequest)
 	}
 
-	var found []*data.Song
-	if name != "" {
-		found = data.AllSongsContaining(name, 0, searchLimit)
-	} else {
-		found = data.AllSongs(0, 0)
-	}
-
 	result := []ListItem{}
-	for _, s := range found {
-		result = append(result, newListItem(s))
+	lastUsed := data.LastUsed()
+	if name == "" {
+		for _, s := range data.FilterSongs(filter) {
+			item := newListItem(s)
+			item.LastUsed = lastUsed[s.RowID]
+			result = append(result, item)
+		}
+		return inout.JSON(result)
+	}
+
+	for _, m := range data.SearchSongs(name, filter, searchLimit) {
+		item := newListItem(m.Song)
+		item.LastUsed = lastUsed[m.Song.RowID]
+		item.Markup = highlight(m.Title)
+		item.Snippet = highlight(m.Snippet)
+		result = append(result, item)
 	}
-
 	return inout.JSON(result)
 }
 
+var highlighter = strings.NewReplacer(
+	data.HighlightStart, "<ins>",
+	data.HighlightEnd, "</ins>",
+)
+
+// highlight escapes the text, and marks the highlighted parts with <ins>
+func highlight(text string) string {
+	return highlighter.Replace(html.EscapeString(text))
+}
+
 func HandleGet(req *inout.Request) *inout.Reply {
 	req.IsAjax()
 	id := req.Int("song_id").Get()
@@ -80,18 +138,31 @@ func HandleGet(req *inout.Request) *inout.Reply {
 	}
 
 	if found := data.SongByID(id); found != nil {
-		return inout.JSON(newListItem(found))
+		return inout.JSON(newListItem(found)).ETag(found.Revision)
 	}
 
 	return inout.Error(http.StatusNotFound, "not found")
 }
 
+// songInput is a song being saved. Revision is the one it was loaded at,
+// unless sent on If-Match.
+type songInput struct {
+	ListItem
+	Revision *int `json:"revision"`
+}
+
+// HandlePut updates the song, if it wasn't changed since it was loaded.
+// Otherwise it replies with a conflict, and the current song.
 func HandlePut(req *inout.Request) *inout.Reply {
 	req.IsAjax()
-	var input ListItem
+	var input songInput
 	if err := req.Read(&input); err != nil {
 		return inout.Error(http.StatusBadRequest, "bad input")
 	}
+	revision, found := req.IfMatch(input.Revision)
+	if !found {
+		return inout.Error(http.StatusPreconditionRequired, "revision required")
+	}
 
 	song := input.Song()
 	if song == nil {
@@ -102,11 +173,21 @@ func HandlePut(req *inout.Request) *inout.Reply {
 		return inout.Error(http.StatusBadRequest, "bad data")
 	}
 
-	if !song.Save() {
+	song.LastMod, _ = users.Current(req)
+	switch err := song.SaveIf(revision); err {
+	case nil:
+	case data.ErrConflict:
+		if current := data.SongByID(song.RowID); current != nil {
+			return inout.Conflict(newListItem(current), current.Revision)
+		}
+		return inout.Error(http.StatusNotFound, "not found")
+	case data.ErrNotFound:
+		return inout.Error(http.StatusNotFound, "not found")
+	default:
 		return inout.Error(http.StatusInternalServerError, "error saving")
 	}
 
-	return inout.JSON(newListItem(song))
+	return inout.JSON(newListItem(song)).ETag(song.Revision)
 }
 
 func HandlePost(req *inout.Request) *inout.Reply {
@@ -125,11 +206,13 @@ func HandlePost(req *inout.Request) *inout.Reply {
 		return inout.Error(http.StatusBadRequest, "bad data")
 	}
 
+	song.Creator, _ = users.Current(req)
+	song.LastMod = song.Creator
 	if !song.Save() {
 		return inout.Error(http.StatusInternalServerError, "error saving")
 	}
 
-	return inout.JSON(newListItem(song))
+	return inout.JSON(newListItem(song)).ETag(song.Revision)
 }
 
 func HandleDelete(req *inout.Request) *inout.Reply {
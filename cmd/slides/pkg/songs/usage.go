@@ -0,0 +1,48 @@
+package songs
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/paupin2/slides/pkg/data"
+)
+
+// UsageReply says where a song was used
+type UsageReply struct {
+	ID       int            `json:"id"`
+	LastUsed string         `json:"last_used,omitempty"` // up to today
+	Decks    []data.SongUse `json:"decks"`               // newest first
+}
+
+// HandleUsage returns the decks which used the song, and the last day it
+// was used on
+func HandleUsage(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	id := req.Int("song_id").Get()
+	if req.Failed() {
+		return nil
+	}
+
+	if data.SongByID(id) == nil {
+		return inout.Error(http.StatusNotFound, "not found")
+	}
+	return inout.JSON(UsageReply{
+		ID:       id,
+		LastUsed: data.LastUsed()[id],
+		Decks:    data.SongUsage(id),
+	})
+}
+
+// HandleUnused returns the songs which weren't used in the last weeks
+func HandleUnused(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	weeks := req.Int("weeks").Def(12).Get()
+	if req.Failed() {
+		return nil
+	} else if weeks < 1 {
+		return inout.Error(http.StatusBadRequest, "bad weeks")
+	}
+
+	return inout.JSON(data.SongsUnusedSince(time.Now().AddDate(0, 0, -7*weeks)))
+}
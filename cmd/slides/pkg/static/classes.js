@@ -1,6 +1,12 @@
 const SongExtraFields = {
     author: 'Author',
     ccli: 'CCLI',
+    copyright: 'Copyright',
+    admin: 'Admin',
+    themes: 'Themes',
+    key: 'Key',
+    tempo: 'Tempo',
+    notes: 'Notes',
 }
 
 class Recent {
@@ -73,6 +79,8 @@ class Song {
         }
         this.imported = false;
         this.modified = null;
+        this.revision = 0;
+        this.lastUsed = null;
         this.slides = [];
 		this.loaded = false;
         this.title = '';
@@ -142,10 +150,18 @@ class Song {
         return `# ${title}\n${text}\n`;
     }
 
+    /** arrangementText returns the arrangement's text, prefixed like pasteText */
+    arrangementText(arrangement) {
+        const title = `${this.title} – ${arrangement.name}` + (this.id ? ` (@${this.id})` : '');
+        return `# ${title}\n${arrangement.text}\n`;
+    }
+
 	change(data) {
         if (data.title) this.title = data.title;
-        if (data.author) this.author = data.author || null;
-        if (data.ccli) this.ccli = data.ccli || null;
+        for (let field in SongExtraFields) {
+            // headers are single lines
+            if (data[field]) this[field] = String(data[field]).replace(/\s*\n\s*/g, ' ');
+        }
         if (data.imported) this.imported = !!data.imported;
         if (data.text) {
             let extra = `# ${this.title}\n`;
@@ -156,6 +172,8 @@ class Song {
             this.initialText = this.text;
         }
         if (data.modified) this.modified = dayjs(data.modified);
+        if (data.revision) this.revision = data.revision;
+        if (data.last_used) this.lastUsed = data.last_used;
     }
 
     load(callback) {
@@ -189,8 +207,12 @@ class Song {
         for (let field in SongExtraFields) {
             data[field] = this[field];
         }
+        data.tempo = parseInt(this.tempo) || 0;
 
-        if (this.id) data.id = this.id;
+        if (this.id) {
+            data.id = this.id;
+            data.revision = this.revision;
+        }
 
 		ajax({method:method, data:data, path:'/song', success:(song)=> {
 			showMessage({msg:`saved "${this.title}"`});
@@ -203,12 +225,25 @@ class Song {
             }
 
 			if (callback) callback(true, this);
-		}, failed: ()=> {
-			showMessage({kind:'error', msg:`error saving "${this.title}"`});
+		}, failed: (current, req)=> {
+			if (req.status == 409) this.merge(current);
+			else showMessage({kind:'error', msg:`error saving "${this.title}"`});
 			if (callback) callback(false, this);
 		}});
 	}
 
+    /** merge offers to merge the changes saved elsewhere into ours */
+    merge(current) {
+        if (!confirm(`"${this.title}" was saved elsewhere since you opened it. Merge those changes into yours?`)) return;
+        const theirs = new Song(current).text;
+        this.text = OT.merge(this.initialText, this.text, theirs);
+        this.initialText = theirs;
+        this.revision = current.revision;
+        this.dirty = true;
+        this.update();
+        showMessage({msg:`merged; check "${this.title}" and save again`});
+    }
+
     revert() {
         if (!this.dirty) return;
         this.text = this.initialText;
@@ -567,6 +602,8 @@ class Deck {
         this.dirty = false;
         this.created = null;
         this.modified = null;
+        this.revision = 0;
+        this.session = null; // editing together, see collab.js
     }
     get date() {
         return dayjs(this.title);
@@ -574,6 +611,10 @@ class Deck {
     get link() {
         return 'screen.html?title='+encodeURIComponent(this.title);
     }
+    /** pdfLink returns the link to print the deck as a booklet */
+    get pdfLink() {
+        return 'deck/export.pdf?layout=booklet&title='+encodeURIComponent(this.title);
+    }
     load(callback) {
         if (this.loaded) {
             if (callback) callback.apply(this, [this]);
@@ -586,6 +627,7 @@ class Deck {
             this.draft = false;
             this.created = dayjs(data.created);
             this.modified = dayjs(data.modified);
+            this.revision = data.revision;
 
             this.text = data.text;
             this.initialText = data.text;
@@ -600,14 +642,33 @@ class Deck {
     }
     save(callback) {
         if (!this.dirty) return;
-        const data = {title:this.title, text:this.text};
-        ajax({method:'PUT', data:data, path:'/deck', success:()=> {
+        if (this.session && this.session.ready) {
+            // saved by the editing session, which says when
+            this.session.save();
+            return;
+        }
+        const data = {title:this.title, text:this.text, revision:this.revision};
+        ajax({method:'PUT', data:data, path:'/deck', success:(saved)=> {
+            this.revision = saved.revision;
+            this.initialText = saved.text;
             this.dirty = false;
             this.draft = false;
             showMessage({msg:`saved "${this.title}`});
             if (callback) callback.apply(this, [this]);
+        }, failed:(current, req) => {
+            if (req.status == 409) this.merge(current);
+            else showMessage({kind:'error', msg:`error saving "${this.title}"`});
         }});
     }
+    /** merge offers to merge the changes saved elsewhere into ours */
+    merge(current) {
+        if (!confirm(`"${this.title}" was saved elsewhere since you opened it. Merge those changes into yours?`)) return;
+        this.text = OT.merge(this.initialText, this.text, current.text);
+        this.initialText = current.text;
+        this.revision = current.revision;
+        this.update();
+        showMessage({msg:`merged; check "${this.title}" and save again`});
+    }
     revert() {
         if (!this.dirty) return;
         this.text = this.initialText;
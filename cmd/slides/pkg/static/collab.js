@@ -0,0 +1,276 @@
+// Collaborative editing of decks, with the server on cmd/slides/pkg/decks/edit.go.
+//
+// Operations are lists of retains (positive numbers), deletes (negative
+// numbers) and inserts (strings), like ot.js, and mirror pkg/ot. Lengths are
+// in UTF-16 code units, as JavaScript strings.
+const OT = {
+	isRetain(c) { return typeof c == 'number' && c > 0; },
+	isDelete(c) { return typeof c == 'number' && c < 0; },
+	isInsert(c) { return typeof c == 'string'; },
+	length(c) { return typeof c == 'string' ? c.length : Math.abs(c); },
+
+	/** builder returns an operation builder, merging components like pkg/ot */
+	builder() {
+		const ops = [];
+		const b = {
+			ops: ops,
+			retain(n) {
+				if (n <= 0) return b;
+				if (OT.isRetain(ops[ops.length-1])) ops[ops.length-1] += n;
+				else ops.push(n);
+				return b;
+			},
+			insert(s) {
+				if (!s) return b;
+				const last = ops.length - 1;
+				if (OT.isInsert(ops[last])) {
+					ops[last] += s;
+				} else if (OT.isDelete(ops[last])) {
+					// inserts always go before deletes
+					if (OT.isInsert(ops[last-1])) ops[last-1] += s;
+					else ops.splice(last, 0, s);
+				} else {
+					ops.push(s);
+				}
+				return b;
+			},
+			delete(n) {
+				if (n <= 0) return b;
+				if (OT.isDelete(ops[ops.length-1])) ops[ops.length-1] -= n;
+				else ops.push(-n);
+				return b;
+			}
+		};
+		return b;
+	},
+
+	/** diff returns the operation changing `from` into `to` */
+	diff(from, to) {
+		let start = 0;
+		while (start < from.length && start < to.length && from[start] == to[start]) start++;
+		let end = 0;
+		while (end < from.length - start && end < to.length - start &&
+			from[from.length-1-end] == to[to.length-1-end]) end++;
+
+		// don't split surrogate pairs, which inserts couldn't be encoded with
+		const high = (s, i) => { const c = s.charCodeAt(i); return c >= 0xd800 && c < 0xdc00; };
+		if (start > 0 && high(from, start-1)) start--;
+		if (end > 0 && high(from, from.length-end-1)) end--;
+		return OT.builder()
+			.retain(start)
+			.insert(to.substring(start, to.length - end))
+			.delete(from.length - start - end)
+			.retain(end).ops;
+	},
+
+	apply(ops, text) {
+		let pos = 0, res = '';
+		for (const c of ops) {
+			if (OT.isRetain(c)) { res += text.substr(pos, c); pos += c; }
+			else if (OT.isInsert(c)) res += c;
+			else pos -= c;
+		}
+		if (pos != text.length) throw 'operation doesn\'t match the text\'s length';
+		return res;
+	},
+
+	/** compose returns an operation with the effect of a followed by b */
+	compose(a, b) {
+		const res = OT.builder();
+		let i = 0, j = 0, ca = a[i++], cb = b[j++];
+		while (ca !== undefined || cb !== undefined) {
+			if (OT.isDelete(ca)) { res.delete(-ca); ca = a[i++]; continue; }
+			if (OT.isInsert(cb)) { res.insert(cb); cb = b[j++]; continue; }
+			if (ca === undefined || cb === undefined) throw 'operations can\'t be composed';
+
+			const n = Math.min(OT.length(ca), OT.length(cb));
+			if (OT.isRetain(ca) && OT.isRetain(cb)) res.retain(n);
+			else if (OT.isInsert(ca) && OT.isRetain(cb)) res.insert(ca.substring(0, n));
+			else if (OT.isRetain(ca) && OT.isDelete(cb)) res.delete(n);
+
+			ca = OT.length(ca) == n ? a[i++] : OT.isInsert(ca) ? ca.substring(n) : ca - n;
+			cb = OT.length(cb) == n ? b[j++] : OT.isDelete(cb) ? cb + n : cb - n;
+		}
+		return res.ops;
+	},
+
+	/** transform returns [a', b'], so a then b' is the same as b then a' */
+	transform(a, b) {
+		const a1 = OT.builder(), b1 = OT.builder();
+		let i = 0, j = 0, ca = a[i++], cb = b[j++];
+		while (ca !== undefined || cb !== undefined) {
+			if (OT.isInsert(ca)) { a1.insert(ca); b1.retain(ca.length); ca = a[i++]; continue; }
+			if (OT.isInsert(cb)) { a1.retain(cb.length); b1.insert(cb); cb = b[j++]; continue; }
+			if (ca === undefined || cb === undefined) throw 'operations can\'t be transformed';
+
+			const n = Math.min(OT.length(ca), OT.length(cb));
+			if (OT.isRetain(ca) && OT.isRetain(cb)) { a1.retain(n); b1.retain(n); }
+			else if (OT.isDelete(ca) && OT.isRetain(cb)) a1.delete(n);
+			else if (OT.isRetain(ca) && OT.isDelete(cb)) b1.delete(n);
+
+			ca = OT.length(ca) == n ? a[i++] : OT.isDelete(ca) ? ca + n : ca - n;
+			cb = OT.length(cb) == n ? b[j++] : OT.isDelete(cb) ? cb + n : cb - n;
+		}
+		return [a1.ops, b1.ops];
+	},
+
+	/** merge returns the text with both our and their changes to base */
+	merge(base, ours, theirs) {
+		const [, theirsAfterOurs] = OT.transform(OT.diff(base, ours), OT.diff(base, theirs));
+		return OT.apply(theirsAfterOurs, ours);
+	},
+
+	/** transformIndex returns where the position is after the operation */
+	transformIndex(index, ops, own) {
+		let pos = 0, res = index;
+		for (const c of ops) {
+			if (pos > index || (pos == index && !own && OT.isInsert(c))) break;
+			if (OT.isRetain(c)) pos += c;
+			else if (OT.isInsert(c)) res += c.length;
+			else { res -= Math.min(index - pos, -c); pos -= c; }
+		}
+		return res;
+	}
+};
+
+/**
+ * EditSession edits a deck together with everyone else editing it.
+ * The server has the text: changes are sent one at a time, and the ones
+ * made meanwhile are buffered, transforming both against others' changes.
+ */
+class EditSession {
+	constructor(deck, args) {
+		this.deck = deck;
+		this.opt = extend({
+			element: null,     // the textarea, to keep the selection
+			editors: null,     // called with the others editing, when it changes
+			closed: null       // called when disconnected
+		}, args);
+		this.rev = 0;
+		this.sent = null;      // waiting for the server's ack
+		this.buffer = null;    // not sent yet
+		this.shadow = null;    // the text, as known to the session
+		this.you = 0;
+		this.ready = false;
+		this.selTimer = null;
+
+		const loc = document.location;
+		const protocol = loc.protocol == 'https:' ? 'wss:' : 'ws:';
+		const qs = new URLSearchParams({title:deck.title});
+		this.socket = new WebSocket(protocol + '//' + loc.host + '/deck/edit?' + qs);
+		this.socket.onmessage = (evt) => this.receive(JSON.parse(evt.data));
+		this.socket.onclose = () => {
+			this.ready = false;
+			if (this.opt.closed) this.opt.closed(this);
+		};
+	}
+
+	close() {
+		this.socket.onclose = null;
+		this.socket.close();
+		this.ready = false;
+	}
+
+	/** pending returns true if there are changes the server didn't apply yet */
+	get pending() {
+		return !!(this.sent || this.buffer);
+	}
+
+	send(msg) {
+		if (this.socket.readyState == WebSocket.OPEN) {
+			this.socket.send(JSON.stringify(msg));
+		}
+	}
+
+	selection() {
+		const elm = this.opt.element;
+		return elm ? [elm.selectionStart, elm.selectionEnd] : [0, 0];
+	}
+
+	/** change sends the changes made to the text since it was last seen */
+	change(text) {
+		if (!this.ready || text == this.shadow) return;
+		const op = OT.diff(this.shadow, text);
+		this.shadow = text;
+		if (this.sent) {
+			this.buffer = this.buffer ? OT.compose(this.buffer, op) : op;
+		} else {
+			this.sent = op;
+			this.send({type:'op', rev:this.rev, op:op, sel:this.selection()});
+		}
+	}
+
+	/** select tells the others where our cursor is, at most every 200ms */
+	select() {
+		if (!this.ready || this.selTimer) return;
+		this.selTimer = setTimeout(() => {
+			this.selTimer = null;
+			this.send({type:'sel', sel:this.selection()});
+		}, 200);
+	}
+
+	save() {
+		this.send({type:'save'});
+	}
+
+	receive(msg) {
+		switch (msg.type) {
+		case 'init':
+			this.rev = msg.rev;
+			this.you = msg.you;
+			this.sent = this.buffer = null;
+			this.shadow = msg.text;
+			this.deck.revision = msg.revision;
+			this.deck.text = this.deck.initialText = msg.text;
+			this.deck.dirty = false;
+			this.ready = true;
+			break;
+
+		case 'ack':
+			this.rev = msg.rev;
+			this.sent = this.buffer;
+			this.buffer = null;
+			if (this.sent) this.send({type:'op', rev:this.rev, op:this.sent, sel:this.selection()});
+			break;
+
+		case 'op':
+			// transform it against our changes, which the server didn't see
+			let op = msg.op;
+			if (this.sent) [this.sent, op] = OT.transform(this.sent, op);
+			if (this.buffer) [this.buffer, op] = OT.transform(this.buffer, op);
+			this.rev = msg.rev;
+			this.shadow = OT.apply(op, this.shadow);
+			this.setText(this.shadow, op);
+			break;
+
+		case 'editors':
+			if (this.opt.editors) this.opt.editors(msg.editors.filter(e => e.id != this.you));
+			break;
+
+		case 'saved':
+			this.deck.revision = msg.revision;
+			this.deck.draft = false;
+			if (!this.pending && this.deck.text == this.shadow) {
+				this.deck.initialText = this.shadow;
+				this.deck.dirty = false;
+			}
+			break;
+
+		case 'error':
+			showMessage({msg:msg.message, kind:'error'});
+			break;
+		}
+	}
+
+	/** setText changes the text, keeping our selection where it was */
+	setText(text, op) {
+		const elm = this.opt.element;
+		const sel = this.selection();
+		this.deck.text = text;
+		if (elm) {
+			Vue.nextTick(() => {
+				elm.setSelectionRange(OT.transformIndex(sel[0], op, false), OT.transformIndex(sel[1], op, false));
+			});
+		}
+	}
+}
@@ -112,7 +112,8 @@ function ajax(args) {
 		qs: '',
 		data: null,
 		success: null,
-		failed: null
+		failed: null,
+		login: true
 	}, args);
 	var request = new XMLHttpRequest();
 	if (opt.qs) {
@@ -141,6 +142,10 @@ function ajax(args) {
 				opt.success(data, request);
 			}
 
+		} else if (request.status == 401 && opt.login && typeof onUnauthorized == 'function') {
+			// not logged in: log in, and retry
+			onUnauthorized(args);
+
 		} else if (opt.failed) {
 			// handle error manually
 			opt.failed(data, request);
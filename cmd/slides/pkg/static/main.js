@@ -5,7 +5,7 @@
 	const style = document.createElement('style');
 	style.innerHTML = rules.join('\n');
 	document.head.appendChild(style);
-})('add,broom,clock,close,copy,discard,edit,forward,hide,imported,refresh,remote,save,screen,trash');
+})('add,broom,clock,close,copy,discard,edit,forward,hide,imported,print,refresh,remote,save,screen,trash');
 
 // dayjs docs: https://day.js.org/docs/en/parse/parse
 const VueCalendar = {
@@ -86,6 +86,50 @@ const VueThumbs = {
 
 const tabs = new Tabs();
 
+/** Screens has the connected screens, kept up to date by watchScreens */
+const Screens = Vue.reactive({list: [], watching: false});
+
+function watchScreens() {
+	if (Screens.watching) return;
+	Screens.watching = true;
+
+	const loc = document.location;
+	const protocol = loc.protocol == 'https:' ? 'wss:' : 'ws:';
+	const replace = (s) => {
+		const i = Screens.list.findIndex(o => o.id == s.id);
+		if (i != -1) Screens.list.splice(i, 1, s);
+		return i != -1;
+	};
+
+	// check first that we're allowed to watch
+	ajax({path:'/screens', login:false, success:(list) => {
+		Screens.list = list;
+		const conn = new WebSocket(protocol + '//' + loc.host + '/screens/watch');
+		extend(conn, {
+			onmessage(evt) {
+				const e = JSON.parse(evt.data);
+				if (e.type == 'list') {
+					Screens.list = e.screens;
+					return;
+				}
+				for (let s of e.screens) {
+					if (e.type == 'disconnected') {
+						Screens.list = Screens.list.filter(o => o.id != s.id);
+					} else if (!replace(s)) {
+						Screens.list.push(s);
+					}
+				}
+			},
+			onclose() {
+				Screens.watching = false;
+				setTimeout(watchScreens, 5000);
+			}
+		});
+	}, failed:() => {
+		Screens.watching = false;
+	}});
+}
+
 function editDeck(deck) {
 	const found = tabs.find('editor', deck.title);
 	if (found) {
@@ -101,16 +145,54 @@ function editDeck(deck) {
 				deck: deck,
 				thumb: null,
 				initialText: deck.text,
+				screens: Screens,
+				session: null,
+				editors: [],
+			}
+		},
+		computed: {
+			screenCount() {
+				return this.screens.list.filter(s => s.title == this.deck.title).length;
+			}
+		},
+		watch: {
+			'deck.text'(text) {
+				if (this.session) this.session.change(text);
 			}
 		},
 		mounted() {
+			watchScreens();
 			this.deck.load(() => {
 				if (this.tab.active && this.tab.vue) {
 					this.tab.vue.$refs.editor.focus();
 				}
+				this.collaborate();
 			});
 		},
+		unmounted() {
+			if (this.session) this.session.close();
+			this.session = this.deck.session = null;
+		},
 		methods: {
+			/** edit together with everyone else editing the deck */
+			collaborate() {
+				this.session = this.deck.session = new EditSession(this.deck, {
+					element: this.$refs.editor,
+					editors: (list) => { this.editors = list; },
+					closed: () => {
+						this.session = this.deck.session = null;
+						this.editors = [];
+						setTimeout(() => {
+							// unsaved changes are kept, and saved as usual
+							if (this.tab.vue && !this.session && !this.deck.dirty) this.collaborate();
+						}, 5000);
+					}
+				});
+			},
+			/** line returns the line the editor's cursor is on */
+			line(editor) {
+				return this.deck.text.substring(0, editor.sel[0]).split('\n').length;
+			},
 			trash() {
 				const t = this.deck.title;
 				if (!confirm('Really delete "' + t + '"?')) return;
@@ -128,6 +210,8 @@ function editDeck(deck) {
 				showContent(this.deck.title, slide.text);
 				this.thumb = slide;
 			},
+			history() { deckHistory(this.deck); },
+			showScreens() { showScreens(this.deck); },
 			addText(text) {
 				this.deck.dirty = true;
 				this.deck.text += '\n' + text + '\n';
@@ -140,6 +224,122 @@ function editDeck(deck) {
 	}}).show();
 }
 
+function deckHistory(deck) {
+	const title = `${deck.title} history`;
+	const found = tabs.find('history', title);
+	if (found) {
+		found.show();
+		found.vue.refresh();
+		return;
+	}
+
+	tabs.add({kind:'history', title:title, icon:'clock', app:{
+		template: '#vue-history',
+		data() {
+			return {deck: deck, revisions: [], selected: null, lines: []};
+		},
+		mounted() {
+			this.refresh();
+		},
+		methods: {
+			refresh() {
+				ajax({path:'/deck/revisions', qs:{title:deck.title}, success:(list) => {
+					this.revisions = list.map(r => extend(r, {created:dayjs(r.created)}));
+				}});
+			},
+			select(rev) {
+				this.selected = rev;
+				ajax({path:'/deck/diff', qs:{title:deck.title, from:rev.revision}, success:(d) => {
+					this.lines = d.lines;
+				}});
+			},
+			restore() {
+				const rev = this.selected;
+				if (!rev || !confirm(`Restore revision ${rev.revision} of "${deck.title}"?`)) return;
+				ajax({method:'POST', path:'/deck/restore', qs:{title:deck.title, revision:rev.revision}, success:(saved) => {
+					showMessage({msg:`restored revision ${rev.revision}`});
+					deck.loaded = false;
+					deck.dirty = false;
+					deck.load();
+					this.refresh();
+				}});
+			}
+		}
+	}}).show();
+}
+
+function showScreens(deck) {
+	const found = tabs.find('screens', 'Screens');
+	if (found) {
+		found.vue.title = deck ? deck.title : '';
+		found.show();
+		return;
+	}
+
+	tabs.add({kind:'screens', title:'Screens', icon:'screen', app:{
+		template: '#vue-screens',
+		data() {
+			return {
+				screens: Screens,
+				title: deck ? deck.title : '',
+				tokens: [],
+				label: '',
+				hours: 3,
+				link: ''
+			};
+		},
+		mounted() {
+			watchScreens();
+			this.loadLinks();
+		},
+		watch: {
+			title() {
+				this.link = '';
+				this.loadLinks();
+			}
+		},
+		computed: {
+			list() {
+				return this.screens.list.filter(s => !this.title || s.title == this.title);
+			},
+			stageLink() {
+				return 'screen.html?' + new URLSearchParams({title:this.title, role:'stage'});
+			}
+		},
+		methods: {
+			time(t) { return t ? dayjs(t).format('HH:mm:ss') : '-'; },
+			day(t) { return t ? dayjs(t).format('YYYY-MM-DD HH:mm') : '-'; },
+			loadLinks() {
+				this.tokens = [];
+				if (!this.title) return;
+				ajax({path:'/screen/tokens', qs:{title:this.title}, success:(list) => {
+					this.tokens = list;
+				}});
+			},
+			createLink() {
+				const input = {title:this.title, label:this.label, hours:this.hours};
+				ajax({method:'POST', path:'/screen/tokens', data:input, success:(t) => {
+					const loc = document.location;
+					this.link = loc.origin + loc.pathname.replace(/[^/]*$/, '') + t.link;
+					this.label = '';
+					this.loadLinks();
+				}});
+			},
+			copyLink() {
+				navigator.clipboard.writeText(this.link).then(() => {
+					showMessage({msg:'Copied to the Clipboard!'});
+				});
+			},
+			revokeLink(t) {
+				if (!confirm("Screens won't be able to connect with this link anymore. Revoke it?")) return;
+				ajax({method:'POST', path:'/screen/tokens/revoke', qs:{id:t.id}, success:() => {
+					this.loadLinks();
+				}});
+			}
+		}
+	}}).show();
+}
+
 function presentDeck(deck) {
 	const found = tabs.find('remote', deck.title);
 	if (found) {
@@ -167,6 +367,12 @@ function presentDeck(deck) {
 				showContent(deck.title, slide.text);
 				this.thumb = slide;
 			},
+			/** move to the next/prev slide, as tracked by the server */
+			move(action) {
+				ajax({method:'POST', path:'/show/'+action, qs:{title:deck.title}, success:(p) => {
+					this.thumb = this.deck.slides[p.index] || null;
+				}});
+			},
 		}
 	}});
 	tab.show();
@@ -199,6 +405,18 @@ const decks_tab = tabs.add({kind:'decks', title:'Decks', app:{
 				this.refreshCount++;
 			});
 		},
+		importPlans() {
+			ajax({method:'POST', path:'/decks/import', success:(list) => {
+				const changed = list.filter(p => p.action == 'created' || p.action == 'updated');
+				const skipped = list.filter(p => p.action == 'skipped');
+				let msg = `imported ${changed.length} plans`;
+				if (skipped.length) msg += `, kept edited decks ${skipped.map(p => p.title).join(', ')}`;
+				showMessage({msg});
+				this.refresh();
+			}, failed: () => {
+				showMessage({kind:'error', msg:'error importing plans'});
+			}});
+		},
 		edit(deck) { editDeck(deck); },
 		present(deck) { presentDeck(deck); }
 	}
@@ -277,13 +495,28 @@ const songs_tab = tabs.add({kind:'songs', title:'Songs', app:{
 		return {
 			songs: Song.All,
 			matches: [],
+			lyrics: [],
 			selected: null,
-			search_text: ''
+			arrangements: [],
+			arrangement: null, // to add, instead of the song's text
+			search_text: '',
+			byRecency: false,
+			lyricsTimeout: null
 		}
 	},
 	created() {
 		this.refresh();
 	},
+	watch: {
+		selected(m) {
+			this.arrangements = [];
+			this.arrangement = null;
+			if (!m || !m.song.id) return;
+			ajax({path:'/song/arrangements', qs:{song_id:m.song.id}, success:(data) => {
+				if (m == this.selected) this.arrangements = data || [];
+			}});
+		}
+	},
 	mounted() {
 		if (this.tab.active && this.tab.vue) {
 			this.tab.vue.$refs.search.focus();
@@ -300,6 +533,11 @@ const songs_tab = tabs.add({kind:'songs', title:'Songs', app:{
 			const norm = normalize(this.search_text.trim()).replace(/\s/g, '');
 			if (!norm) {
 				this.matches = this.songs.map(s => ({song:s}));
+				if (this.byRecency) {
+					// most recently sung first, then the ones never sung
+					this.matches.sort((a, b) => (b.song.lastUsed || '').localeCompare(a.song.lastUsed || ''));
+				}
+				this.lyrics = [];
 				return;
 			}
 
@@ -314,6 +552,27 @@ const songs_tab = tabs.add({kind:'songs', title:'Songs', app:{
 			});
 			matches.sort((a, b) => a.score < b.score);
 			this.matches = matches;
+			this.searchLyrics();
+		},
+		/** searchLyrics looks for the text on the lyrics, authors and CCLI numbers */
+		searchLyrics() {
+			clearTimeout(this.lyricsTimeout);
+			const text = this.search_text.trim();
+			if (text.length < 3) {
+				this.lyrics = [];
+				return;
+			}
+
+			this.lyricsTimeout = setTimeout(() => {
+				ajax({path:'/songs', qs:{name:text}, success:(data) => {
+					if (text != this.search_text.trim()) return; // outdated
+					const titleMatches = {};
+					this.matches.forEach(m => titleMatches[m.song.id] = true);
+					this.lyrics = (data || [])
+						.filter(s => !titleMatches[s.id])
+						.map(s => ({song: Song.ById[s.id] || new Song(s), snippet: s.snippet}));
+				}});
+			}, 300);
 		},
 		/** adds the current song to either the last selected editor */
 		addToEditor() {
@@ -326,7 +585,13 @@ const songs_tab = tabs.add({kind:'songs', title:'Songs', app:{
 			}
 
 			// load the song
-			const song = this.selected.song;
+			const song = this.selected.song, arrangement = this.arrangement;
+			if (arrangement) {
+				tab.vue.addText(song.arrangementText(arrangement));
+				tab.show();
+				showMessage({msg:`Added "${song.title}" (${arrangement.name}) to ${tab.title}`});
+				return;
+			}
 			song.load((song) => {
 				if (!song.text) {
 					showMessage({kind:'error', msg:`No text for "${song.title}"...`});
@@ -342,6 +607,10 @@ const songs_tab = tabs.add({kind:'songs', title:'Songs', app:{
 			this.search_text = '';
 			this.search();
 		},
+		sortByRecency() {
+			this.byRecency = !this.byRecency;
+			this.search();
+		},
 		copy() {
 			ajax({path:"/song", qs:{song_id:this.selected.song.id}, success: (data) => {
 				navigator.clipboard.writeText(data.text).then(() => {
@@ -443,7 +712,8 @@ const songs_tab = tabs.add({kind:'songs', title:'Songs', app:{
 							// re-run search
 							songs_tab.vue.search();
 
-						}, failed: ()=> {
+						}, failed: (current, req)=> {
+							if (req.status == 409) return this.song.merge(current);
 							this.load(this.song);
 							showMessage({kind:'error', msg:'error saving '+this.song.title});
 						}});
@@ -498,12 +768,79 @@ document.addEventListener('keydown', function(e) {
 			}
 		}
 	}
+	if (!handled && tabs.active && tabs.active.kind == 'remote' && tabs.active.vue) {
+		// arrows and clickers (page up/down) move between slides
+		switch (e.key) {
+			case 'ArrowRight': case 'ArrowDown': case 'PageDown':
+				handled = true;
+				tabs.active.vue.move('next');
+				break;
+			case 'ArrowLeft': case 'ArrowUp': case 'PageUp':
+				handled = true;
+				tabs.active.vue.move('prev');
+				break;
+		}
+	}
 	if (handled) {
 		e.stopImmediatePropagation();
 		e.preventDefault();
 	}
 });
 
+/** user shows the logged-in user's name, and a button to log out */
+const user = Vue.createApp({
+	template: '#vue-user',
+	data() {
+		return {name: null};
+	},
+	mounted() {
+		ajax({path:'/me', login:false, success:(u) => this.name = u.name, failed:() => this.name = null});
+	},
+	methods: {
+		login() { showLogin(); },
+		logout() {
+			ajax({method:'POST', path:'/logout', success:() => {
+				this.name = null;
+				showMessage({msg:'logged out'});
+			}});
+		}
+	}
+}).mount('#user');
+
+/** showLogin opens the login tab, retrying the request that needed it */
+function showLogin(retry) {
+	const found = tabs.find('login', 'Login');
+	if (found) {
+		found.show();
+		return;
+	}
+
+	tabs.add({kind:'login', title:'Login', app:{
+		template: '#vue-login',
+		data() {
+			return {username: '', password: ''};
+		},
+		methods: {
+			login() {
+				const data = {username:this.username, password:this.password};
+				ajax({method:'POST', path:'/login', data:data, login:false, success:(u) => {
+					user.name = u.name;
+					showMessage({msg:`logged in as ${u.name}`});
+					this.tab.close();
+					if (retry) ajax(retry);
+				}, failed:() => {
+					showMessage({kind:'error', msg:'bad username or password'});
+				}});
+			}
+		}
+	}}).show();
+}
+
+function onUnauthorized(request) {
+	showMessage({kind:'error', msg:'please log in first'});
+	showLogin(request);
+}
+
 ajax({method:'GET', path:'/version', success:(version)=> {
 	// show version
 	document.querySelector('#version').innerText = version || 'no-version';
@@ -16,9 +16,19 @@ function declick(delay) {
 
 const body = document.body,
 	container = document.querySelector('#container'),
-	ref = document.querySelector('#ref');
+	ref = document.querySelector('#ref'),
+	section = document.querySelector('#section'),
+	next = document.querySelector('#next'),
+	footer = document.querySelector('#footer');
 
-let lastText = '';
+let lastText = '', lastHash = '', lastFooter = '', lastStage = null, socket = null;
+
+// stage screens also show the section, the next slide and the chords
+const stage = new URLSearchParams(document.location.search).get('role') == 'stage';
+
+// see protocol.go
+const protocolVersion = 1;
+const clientVersion = 'screen.js/1';
 
 const nbsp = (function() {
 	const elm = document.createElement('div');
@@ -27,10 +37,19 @@ const nbsp = (function() {
 })();
 
 function updateText() {
+	if (lastStage) {
+		updateStage();
+		return;
+	}
+
+	// the song's attribution, in small print
+	footer.innerText = lastFooter;
+	bodyclass('footer', !!lastFooter);
+
     const padding = 20;
     const dims = {
 		width: window.innerWidth-padding,
-		height: window.innerHeight-padding
+		height: window.innerHeight-padding-footer.offsetHeight
 	};
 
 	let text = lastText;
@@ -45,10 +64,55 @@ function updateText() {
 	container.style.fontSize = size + 'pt';
 	container.innerText = text;
 	document.body.classList.toggle('subtitles', subtitles);
+	sendStatus('status');
+}
+
+/** updateStage shows the last message for stage screens */
+function updateStage() {
+	const st = lastStage;
+	section.innerText = [st.song, st.section].filter(s => s).join(' · ');
+	next.innerText = st.next ? [st.next.section, st.next.text.replace(/\n/g, ' / ')].filter(s => s).join(': ') : '';
+	bodyclass('blank', st.blank);
+
+	const dims = {
+		width: window.innerWidth - 40,
+		height: window.innerHeight - section.offsetHeight - next.offsetHeight - 40
+	};
+	if (st.chords) {
+		// keep the chords aligned with a monospaced font
+		const lines = st.chords.split('\n');
+		const longest = Math.max(...lines.map(l => l.length));
+		const size = Math.min(dims.height / lines.length / 1.4, dims.width / longest / 0.6, 60);
+		container.style.fontSize = Math.max(size, 8) + 'px';
+		container.innerText = st.chords;
+	} else {
+		container.style.fontSize = fitText(extend(dims, {text:st.text})) + 'pt';
+		container.innerText = st.text;
+	}
+	bodyclass('chords', !!st.chords);
+	sendStatus('status');
+}
+
+/** send a message to the server, if connected */
+function send(type, data) {
+	if (!socket || socket.readyState != WebSocket.OPEN) return;
+	socket.send(JSON.stringify(extend({v:protocolVersion, type:type}, data)));
 }
 
-function update(text) {
+/** sendStatus reports what's being shown, and how */
+function sendStatus(type) {
+	send(type, {
+		client: clientVersion,
+		viewport: {width:window.innerWidth, height:window.innerHeight},
+		visible: document.visibilityState == 'visible',
+		hash: lastHash
+	});
+}
+
+function update(text, hash, footer) {
 	lastText = text || '';
+	lastHash = hash || '';
+	lastFooter = footer || '';
 	updateText();
 	log('updated to "' + text.replace(/\n/g, ' ').substr(0, 20) + '…"');
 }
@@ -71,20 +135,55 @@ function ping() {
     }, 1000);
 }
 
+/** receive handles a message from the server */
+function receive(evt) {
+	ping();
+	let data;
+	try {
+		data = JSON.parse(evt.data);
+	} catch (error) {
+		send('error', {message:'bad message: ' + error});
+		return;
+	}
+	if (data.type == 'error') {
+		log('server error: ' + data.message);
+		return;
+	}
+	if (data.type == 'stage') {
+		lastStage = data;
+	}
+	update(data.text || '', data.hash, data.footer);
+}
+
+// use server-sent events if asked to, or if websockets never connect
+const maxSocketFailures = 3;
+let socketFailures = 0;
+
 let retryTimeout = declick(2 * 1000);
 function initSocket() {
 	const loc = document.location;
+	if (socketFailures >= maxSocketFailures || new URLSearchParams(loc.search).get('transport') == 'events') {
+		initEvents();
+		return;
+	}
+
 	const protocol = loc.protocol == 'https:' ? 'wss:' : 'ws:';
 	const address = protocol + '//' + loc.host + '/screen' + loc.search;
 	const conn = new WebSocket(address);
+	let opened = false;
+	socket = conn;
 	extend(conn, {
 		onopen() {
 			log('opened socket to ' + address);
+			opened = true;
+			socketFailures = 0;
             bodyclass('connected', true);
+			sendStatus('hello');
 		},
 		onclose() {
 			log('socket closed');
             bodyclass('connected', false);
+			if (!opened) socketFailures++;
 			retryTimeout(initSocket);
 		},
 		onerror() {
@@ -92,17 +191,24 @@ function initSocket() {
             bodyclass('connected', false);
 			retryTimeout(initSocket);
 		},
-		onmessage(evt) {
-            ping();
-			let slide = '';
-			try {
-				const data = JSON.parse(evt.data);
-				slide = data.text || '';
-			} catch (error) {
-				return;
-			}
-			update(slide);
+		onmessage: receive,
+	});
+}
+
+/** initEvents receives the content as server-sent events, which reconnect by themselves */
+function initEvents() {
+	const address = '/screen/events' + document.location.search;
+	const events = new EventSource(address);
+	extend(events, {
+		onopen() {
+			log('receiving events from ' + address);
+            bodyclass('connected', true);
+		},
+		onerror() {
+            log('events error');
+            bodyclass('connected', false);
 		},
+		onmessage: receive,
 	});
 }
 
@@ -119,9 +225,12 @@ function toggleFullScreen(e) {
 
 let resizeTimeout = declick(250);
 window.onresize = () => { resizeTimeout(updateText); }
+document.addEventListener('visibilitychange', () => sendStatus('status'));
+window.addEventListener('error', (e) => send('error', {message:e.message}));
 body.addEventListener('dblclick', toggleFullScreen);
 container.addEventListener('dblclick', toggleFullScreen);
 
 // start the websocket
+bodyclass('stage', stage);
 update('connecting');
 initSocket();
\ No newline at end of file
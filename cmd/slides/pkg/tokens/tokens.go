@@ -0,0 +1,61 @@
+// Package tokens handles the links to screens, for people who can't log in
+package tokens
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/paupin2/slides/cmd/slides/pkg/users"
+	"github.com/paupin2/slides/pkg/data"
+)
+
+// TokenReply is a new token, with the link to the screen using it
+type TokenReply struct {
+	data.ScreenToken
+	Token string `json:"token"`
+	Link  string `json:"link"`
+}
+
+// HandleList lists the tokens which didn't expire, of a deck or all
+func HandleList(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	title := req.Str("title").Def("").Get()
+	if req.Failed() {
+		return nil
+	}
+
+	list := data.ScreenTokens(title)
+	if list == nil {
+		list = []data.ScreenToken{}
+	}
+	return inout.JSON(list)
+}
+
+// HandleCreate creates a token for a deck's screens
+func HandleCreate(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	var input struct {
+		Title string `json:"title"`
+		Label string `json:"label"`
+		Hours int    `json:"hours"`
+	}
+	if err := req.Read(&input); err != nil {
+		return inout.Error(http.StatusBadRequest, "could not read data")
+	}
+
+	user, _ := users.Current(req)
+	d := time.Duration(input.Hours) * time.Hour
+	token, st, err := data.NewScreenToken(input.Title, input.Label, user, d)
+	if err != nil {
+		return inout.Error(http.StatusBadRequest, "error: %v", err)
+	}
+
+	q := url.Values{"title": {st.Title}, "token": {token}}
+	return inout.JSON(TokenReply{
+		ScreenToken: st,
+		Token:       token,
+		Link:        "screen.html?" + q.Encode(),
+	})
+}
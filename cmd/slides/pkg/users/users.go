@@ -0,0 +1,98 @@
+package users
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/paupin2/slides/pkg/config"
+	"github.com/paupin2/slides/pkg/data"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	cookieName = "session"
+)
+
+// Current returns the logged-in user, if any
+func Current(req *inout.Request) (data.User, bool) {
+	token := req.Cookie(cookieName)
+	if token == "" {
+		return data.User{}, false
+	}
+	return data.SessionUser(token)
+}
+
+// sessionCookie returns the cookie for the token; an empty token removes it
+func sessionCookie(token string) *http.Cookie {
+	c := &http.Cookie{
+		Name:     cookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   strings.HasPrefix(config.Config.BaseURL, "https:"),
+	}
+	if token == "" {
+		c.MaxAge = -1
+	} else {
+		c.Expires = time.Now().Add(data.SessionDuration)
+	}
+	return c
+}
+
+type UserReply struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+}
+
+func HandleLogin(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	var input struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := req.Read(&input); err != nil {
+		return inout.Error(http.StatusBadRequest, "could not read data")
+	}
+
+	user, ok := data.Authenticate(input.Username, input.Password)
+	if !ok {
+		log.Info().Str("user", input.Username).Msg("login failed")
+		return inout.Error(http.StatusUnauthorized, "bad username or password")
+	}
+
+	token, err := data.NewSession(user)
+	if err != nil {
+		return inout.Error(http.StatusInternalServerError, "could not log in")
+	}
+
+	log.Info().Str("user", user.ID).Msg("logged in")
+	reply := inout.JSON(UserReply{Username: user.ID, Name: user.Name})
+	reply.SetCookie(sessionCookie(token))
+	return reply
+}
+
+func HandleLogout(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	if token := req.Cookie(cookieName); token != "" {
+		if err := data.EndSession(token); err != nil {
+			return inout.Error(http.StatusInternalServerError, "could not log out")
+		}
+	}
+
+	reply := inout.OK()
+	reply.SetCookie(sessionCookie(""))
+	return reply
+}
+
+// HandleMe returns the logged-in user
+func HandleMe(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	user, ok := Current(req)
+	if !ok {
+		return inout.Error(http.StatusUnauthorized, "not logged in")
+	}
+	return inout.JSON(UserReply{Username: user.ID, Name: user.Name})
+}
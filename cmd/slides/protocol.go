@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// ProtocolVersion is the version of the messages exchanged with screens.
+// Every message is a JSON object with the version as `v`, and its `type`.
+const ProtocolVersion = 1
+
+// message types
+const (
+	msgContent = "content" // server: what to show
+	msgStage   = "stage"   // server: what to show on stage screens
+	msgHello   = "hello"   // screen: sent after connecting
+	msgStatus  = "status"  // screen: sent after showing content, or when it changes
+	msgError   = "error"   // both: something went wrong
+)
+
+// Content is what screens show
+type Content struct {
+	Version int    `json:"v"`
+	Type    string `json:"type"`
+	Text    string `json:"text"`
+	Hash    string `json:"hash"`             // screens report it back, once they show the text
+	Footer  string `json:"footer,omitempty"` // song attribution, shown in small print
+}
+
+func newContent(text string) Content {
+	return Content{
+		Version: ProtocolVersion,
+		Type:    msgContent,
+		Text:    text,
+		Hash:    contentHash(text),
+	}
+}
+
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ErrorMessage is sent to screens when their messages can't be handled
+type ErrorMessage struct {
+	Version int    `json:"v"`
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+func newErrorMessage(format string, a ...any) ErrorMessage {
+	return ErrorMessage{
+		Version: ProtocolVersion,
+		Type:    msgError,
+		Message: fmt.Sprintf(format, a...),
+	}
+}
+
+// Viewport is the size of a screen, in CSS pixels
+type Viewport struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// ScreenMessage is a message sent by a screen. Fields not sent are left
+// unchanged on the screen's status.
+type ScreenMessage struct {
+	Version  int       `json:"v"`
+	Type     string    `json:"type"`
+	Client   string    `json:"client,omitempty"`   // hello: client name and version
+	Viewport *Viewport `json:"viewport,omitempty"` // hello, status
+	Visible  *bool     `json:"visible,omitempty"`  // hello, status: false if the page is hidden
+	Hash     *string   `json:"hash,omitempty"`     // hello, status: of the content being shown
+	Message  string    `json:"message,omitempty"`  // error
+}
+
+// ScreenStatus is what a screen reported about itself
+type ScreenStatus struct {
+	Client   string     `json:"client"`
+	Viewport Viewport   `json:"viewport"`
+	Visible  bool       `json:"visible"`
+	Hash     string     `json:"hash"`
+	Error    string     `json:"error,omitempty"` // last error
+	ErrorAt  *time.Time `json:"error_at,omitempty"`
+	Updated  *time.Time `json:"updated,omitempty"` // last time it reported anything
+}
+
+// apply updates the status with the message
+func (st *ScreenStatus) apply(m ScreenMessage, now time.Time) error {
+	if m.Version > ProtocolVersion {
+		return fmt.Errorf("unsupported version %d", m.Version)
+	}
+
+	switch m.Type {
+	case msgHello, msgStatus:
+		if m.Type == msgHello {
+			st.Client = m.Client
+		}
+		if m.Viewport != nil {
+			st.Viewport = *m.Viewport
+		}
+		if m.Visible != nil {
+			st.Visible = *m.Visible
+		}
+		if m.Hash != nil {
+			st.Hash = *m.Hash
+		}
+	case msgError:
+		st.Error = m.Message
+		st.ErrorAt = &now
+	default:
+		return fmt.Errorf("unknown message type %q", m.Type)
+	}
+
+	st.Updated = &now
+	return nil
+}
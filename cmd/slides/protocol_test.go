@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScreenStatus(t *testing.T) {
+	var st ScreenStatus
+	now := time.Now()
+	visible, hash := true, contentHash("one")
+
+	err := st.apply(ScreenMessage{Version: 1, Type: msgHello, Client: "screen.js/1",
+		Viewport: &Viewport{800, 600}, Visible: &visible, Hash: &hash}, now)
+	if err != nil {
+		t.Fatal(err)
+	} else if st.Client != "screen.js/1" || st.Viewport.Width != 800 || !st.Visible || st.Hash != hash {
+		t.Errorf("bad status after hello: %+v", st)
+	}
+
+	// status only changes what's sent
+	visible = false
+	if err = st.apply(ScreenMessage{Type: msgStatus, Visible: &visible}, now); err != nil {
+		t.Fatal(err)
+	} else if st.Visible || st.Hash != hash || st.Client != "screen.js/1" {
+		t.Errorf("bad status after status: %+v", st)
+	}
+
+	if err = st.apply(ScreenMessage{Type: msgError, Message: "oops"}, now); err != nil {
+		t.Fatal(err)
+	} else if st.Error != "oops" || st.ErrorAt == nil {
+		t.Errorf("bad status after error: %+v", st)
+	}
+
+	if err = st.apply(ScreenMessage{Version: 2, Type: msgStatus}, now); err == nil {
+		t.Error("expected an error for a newer version")
+	}
+	if err = st.apply(ScreenMessage{Type: "other"}, now); err == nil {
+		t.Error("expected an error for an unknown type")
+	}
+}
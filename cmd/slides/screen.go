@@ -4,73 +4,204 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/paupin2/slides/cmd/slides/pkg/users"
 	"github.com/paupin2/slides/pkg/data"
 	"github.com/rs/zerolog/log"
 )
 
-type Content struct {
-	Text string `json:"text"`
-}
+// screen transports
+const (
+	transportWebsocket = "websocket"
+	transportEvents    = "events" // server-sent events: screens can't report their status
+)
 
 type Screen struct {
-	title    string
-	conn     *websocket.Conn
-	shutdown func()
-	updates  chan []byte
+	id        int
+	title     string
+	role      string // roleAudience or roleStage
+	transport string
+	addr      string
+	token     *data.ScreenToken // the link it connected with; nil for logged-in users
+	expiry    *time.Timer       // disconnects it when the link expires
+	connected time.Time
+	conn      *websocket.Conn // websocket screens only
+	stop      func()          // disconnects the screen
+	shutdown  func()
+	changed   func()        // called when the screen reports its status
+	out       *slot         // the latest content, not sent yet
+	replies   chan []byte   // error replies to the screen's messages
+	closed    chan struct{} // closed when reading fails
+
+	lock        sync.Mutex
+	status      ScreenStatus
+	lastPing    *time.Time // last pong received
+	lastSent    *time.Time
+	lastMessage []byte
 }
 
-func (srv *Server) HandleScreen(req *inout.Request) *inout.Reply {
-	title := req.Str("title").Get()
+// Status returns what the screen last reported
+func (scr *Screen) Status() ScreenStatus {
+	scr.lock.Lock()
+	defer scr.lock.Unlock()
+	return scr.status
+}
+
+// sent records the message sent to the screen
+func (scr *Screen) sent(msg []byte) {
+	now := time.Now()
+	scr.lock.Lock()
+	scr.lastSent, scr.lastMessage = &now, msg
+	scr.lock.Unlock()
+}
+
+// screenRequest checks the request of a screen, returning the deck, role
+// and the link used (nil for logged-in users), or the reply if it's not
+// allowed
+func screenRequest(req *inout.Request) (title, role string, token *data.ScreenToken, reply *inout.Reply) {
+	title = req.Str("title").Get()
 	if req.Failed() {
-		return inout.Error(http.StatusBadRequest, "bad title")
+		return "", "", nil, inout.Error(http.StatusBadRequest, "bad title")
 	}
-	if err := data.CheckTitle(title); err != nil {
-		return inout.Error(http.StatusBadRequest, "bad title")
+	title, err := resolveTitle(title)
+	if err != nil {
+		return "", "", nil, inout.Error(http.StatusBadRequest, "bad title")
 	}
 
-	conn, err := req.Upgrade()
-	if err != nil {
-		log.Error().Err(err).Msg("upgrading socket")
-		return inout.Error(http.StatusInternalServerError, "error connecting")
+	role = req.Str("role").Def(roleAudience).Get()
+	if !validRole(role) {
+		return "", "", nil, inout.Error(http.StatusBadRequest, "bad role")
 	}
 
-	screen := &Screen{
-		title:   title,
-		conn:    conn,
-		updates: make(chan []byte, 10),
-		shutdown: func() {
-			// remove screen when the connection shuts down
+	// logged-in users, or those with a link
+	if _, ok := users.Current(req); ok {
+		return title, role, nil, nil
+	}
+	st, ok := data.ScreenTokenFor(req.Str("token").Def("").Get(), title)
+	if !ok {
+		return "", "", nil, inout.Error(http.StatusUnauthorized, "not allowed")
+	}
+	return title, role, &st, nil
+}
+
+// HandleRevokeToken stops a screen link from being used, and disconnects
+// this instance's screens using it
+func (srv *Server) HandleRevokeToken(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	id := req.Int("id").Get()
+	if req.Failed() {
+		return nil
+	}
+
+	if err := data.RevokeScreenToken(id); err == data.ErrNotFound {
+		return inout.Error(http.StatusNotFound, "not found")
+	} else if err != nil {
+		return inout.Error(http.StatusInternalServerError, "error revoking")
+	}
+	srv.disconnectScreens(func(scr *Screen) bool {
+		return scr.token != nil && scr.token.ID == id
+	})
+	return inout.OK()
+}
+
+// disconnectScreens disconnects the screens for which `match` is true
+func (srv *Server) disconnectScreens(match func(scr *Screen) bool) {
+	var found []*Screen
+	srv.lock.RLock()
+	for _, scrs := range srv.screens {
+		for _, scr := range scrs {
+			if match(scr) {
+				found = append(found, scr)
+			}
+		}
+	}
+	srv.lock.RUnlock()
+
+	for _, scr := range found {
+		log.Info().Str("deck", scr.title).Str("client", scr.addr).Msg("disconnecting screen")
+		scr.disconnect()
+	}
+}
+
+// addScreen registers the screen, so it gets the deck's broadcasts until
+// it shuts down
+func (srv *Server) addScreen(screen *Screen) {
+	screen.connected = time.Now()
+	screen.out = newSlot()
+
+	var once sync.Once
+	screen.shutdown = func() {
+		// remove screen when the connection shuts down
+		once.Do(func() {
 			srv.lock.Lock()
-			defer srv.lock.Unlock()
-			scrs := srv.screens[title]
+			if screen.expiry != nil {
+				screen.expiry.Stop()
+			}
+			scrs := srv.screens[screen.title]
 			for i, cl := range scrs {
-				if cl.conn == conn {
-					// remove screen
-					srv.screens[title] = append(scrs[:i], scrs[i+1:]...)
-					return
+				if cl == screen {
+					srv.screens[screen.title] = append(scrs[:i], scrs[i+1:]...)
+					break
 				}
 			}
-			return
-		},
+			srv.lock.Unlock()
+			srv.notify(screenDisconnected, screen)
+		})
+	}
+	screen.changed = func() {
+		srv.notify(screenStatus, screen)
 	}
 
-	// add the screen
 	srv.lock.Lock()
-	srv.screens[title] = append(srv.screens[title], screen)
+	srv.lastScreenID++
+	screen.id = srv.lastScreenID
+	srv.screens[screen.title] = append(srv.screens[screen.title], screen)
+	if screen.token != nil {
+		screen.expiry = time.AfterFunc(time.Until(screen.token.Expires), screen.disconnect)
+	}
 	srv.lock.Unlock()
+	srv.notify(screenConnected, screen)
+}
+
+// HandleScreen connects a screen through a websocket
+func (srv *Server) HandleScreen(req *inout.Request) *inout.Reply {
+	title, role, token, reply := screenRequest(req)
+	if reply != nil {
+		return reply
+	}
+
+	conn, err := req.Upgrade()
+	if err != nil {
+		log.Error().Err(err).Msg("upgrading socket")
+		return inout.Error(http.StatusInternalServerError, "error connecting")
+	}
 
-	// start writer, send current slide (if any)
+	screen := &Screen{
+		title:     title,
+		role:      role,
+		transport: transportWebsocket,
+		addr:      req.RemoteAddr(),
+		token:     token,
+		conn:      conn,
+		stop:      func() { conn.Close() },
+		replies:   make(chan []byte, 4),
+		closed:    make(chan struct{}),
+	}
+	srv.addScreen(screen)
+
+	// start reader and writer, send current slide (if any)
+	go screen.reader()
 	go screen.writer()
-	_ = screen.SendJSON(Content{srv.get(title)})
-	return inout.Status(http.StatusOK)
+	_ = screen.SendJSON(srv.payload(screen, srv.get(title)))
+	return inout.Handled()
 }
 
-// Broadcast the data to all of this deck's screeens
-func (s *Server) Broadcast(title string, data any) {
+// Broadcast the data to all of this deck's screeens with the role
+func (s *Server) Broadcast(title, role string, data any) {
 	// encode data if necessary
 	var msg []byte
 	if b, isBytes := data.([]byte); isBytes {
@@ -92,9 +223,11 @@ func (s *Server) Broadcast(title string, data any) {
 	// get list of screens
 	s.lock.Lock()
 	screens := s.screens[title]
-	ls := make([]*Screen, len(screens))
-	for i, s := range screens {
-		ls[i] = s
+	ls := make([]*Screen, 0, len(screens))
+	for _, s := range screens {
+		if s.role == role {
+			ls = append(ls, s)
+		}
 	}
 	s.lock.Unlock()
 
@@ -108,16 +241,34 @@ const (
 	// Time allowed to write a message to the peer.
 	writeWait = 10 * time.Second
 
+	// Time allowed to read the next message (or pong) from the peer.
+	pongWait = 60 * time.Second
+
 	// Send pings to peer with this period. Must be less than pongWait.
-	pingPeriod = 60 * time.Second
+	pingPeriod = 50 * time.Second
+
+	// Maximum size of the messages sent by screens.
+	maxMessageSize = 4096
 )
 
 func (c *Screen) OnShutdown(fn func()) {
 	c.shutdown = fn
 }
 
+// Send queues the message, replacing the one not sent yet, if any. It
+// never blocks: screens that stay stuck are disconnected instead.
 func (c *Screen) Send(msg []byte) {
-	c.updates <- msg
+	if !c.out.put(msg, time.Now()) {
+		log.Warn().Str("deck", c.title).Str("client", c.addr).Msg("dropping stuck screen")
+		c.disconnect()
+	}
+}
+
+// disconnect closes the screen's connection, and removes it right away: a
+// stalled write may take a while to fail
+func (c *Screen) disconnect() {
+	c.stop()
+	c.shutdown()
 }
 
 func (c *Screen) SendJSON(data any) error {
@@ -125,7 +276,7 @@ func (c *Screen) SendJSON(data any) error {
 	if err := json.NewEncoder(&buf).Encode(data); err != nil {
 		return err
 	}
-	c.updates <- buf.Bytes()
+	c.Send(buf.Bytes())
 	return nil
 }
 
@@ -139,6 +290,7 @@ func (scr *Screen) writer() {
 	defer func() {
 		ticker.Stop()
 		scr.conn.Close()
+		scr.out.drop()
 		if scr.shutdown != nil {
 			scr.shutdown()
 		}
@@ -148,17 +300,27 @@ func (scr *Screen) writer() {
 	scrlog.Debug().Msg("connected")
 	for {
 		select {
-		case update, ok := <-scr.updates:
+		case <-scr.out.ready:
+			update := scr.out.take()
+			if update == nil {
+				continue
+			}
+
 			_ = scr.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				_ = scr.conn.WriteMessage(websocket.CloseMessage, []byte{})
+			if err := scr.conn.WriteMessage(websocket.TextMessage, update); err != nil {
 				return
 			}
+			scr.sent(update)
 
-			if err := scr.conn.WriteMessage(websocket.TextMessage, update); err != nil {
+		case reply := <-scr.replies:
+			_ = scr.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := scr.conn.WriteMessage(websocket.TextMessage, reply); err != nil {
 				return
 			}
 
+		case <-scr.closed:
+			return
+
 		case <-ticker.C:
 			_ = scr.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := scr.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -167,3 +329,58 @@ func (scr *Screen) writer() {
 		}
 	}
 }
+
+// reader handles the messages sent by the screen, until the connection fails
+func (scr *Screen) reader() {
+	scrlog := log.With().
+		Str("deck", scr.title).
+		Str("client", scr.conn.RemoteAddr().String()).
+		Logger()
+	defer close(scr.closed)
+
+	scr.conn.SetReadLimit(maxMessageSize)
+	_ = scr.conn.SetReadDeadline(time.Now().Add(pongWait))
+	scr.conn.SetPongHandler(func(string) error {
+		now := time.Now()
+		scr.lock.Lock()
+		scr.lastPing = &now
+		scr.lock.Unlock()
+		return scr.conn.SetReadDeadline(now.Add(pongWait))
+	})
+
+	for {
+		_, buf, err := scr.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				scrlog.Debug().Err(err).Msg("reading")
+			}
+			return
+		}
+		_ = scr.conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		var msg ScreenMessage
+		if err = json.Unmarshal(buf, &msg); err == nil {
+			scr.lock.Lock()
+			err = scr.status.apply(msg, time.Now())
+			scr.lock.Unlock()
+		}
+		if err != nil {
+			scrlog.Debug().Err(err).Msg("bad message")
+			if reply, err := json.Marshal(newErrorMessage("%v", err)); err == nil {
+				select {
+				case scr.replies <- reply:
+				default: // don't block reading if the screen isn't keeping up
+					scr.out.discarded()
+				}
+			}
+			continue
+		}
+
+		if msg.Type == msgError {
+			scrlog.Warn().Str("error", msg.Message).Msg("screen error")
+		}
+		if scr.changed != nil {
+			scr.changed()
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/paupin2/slides/pkg/data"
+	"github.com/rs/zerolog/log"
+)
+
+// ScreenInfo describes a connected screen
+type ScreenInfo struct {
+	ID          int             `json:"id"`
+	Title       string          `json:"title"`
+	Role        string          `json:"role"`
+	Transport   string          `json:"transport"`
+	Address     string          `json:"address"`
+	Connected   time.Time       `json:"connected"`
+	LastPing    *time.Time      `json:"last_ping,omitempty"` // last pong received
+	LastSent    *time.Time      `json:"last_sent,omitempty"`
+	LastMessage json.RawMessage `json:"last_message,omitempty"`
+	InSync      bool            `json:"in_sync"`   // reported showing the current content
+	Coalesced   int             `json:"coalesced"` // messages replaced by newer ones before being sent
+	Dropped     int             `json:"dropped"`   // messages never sent
+	Status      ScreenStatus    `json:"status"`
+}
+
+// Info describes the screen; `current` is the deck's current content
+func (scr *Screen) Info(current Content) ScreenInfo {
+	coalesced, dropped := scr.out.counts()
+	scr.lock.Lock()
+	defer scr.lock.Unlock()
+	return ScreenInfo{
+		ID:          scr.id,
+		Title:       scr.title,
+		Role:        scr.role,
+		Transport:   scr.transport,
+		Address:     scr.addr,
+		Connected:   scr.connected,
+		LastPing:    scr.lastPing,
+		LastSent:    scr.lastSent,
+		LastMessage: json.RawMessage(scr.lastMessage),
+		InSync:      scr.status.Hash == current.Hash,
+		Coalesced:   coalesced,
+		Dropped:     dropped,
+		Status:      scr.status,
+	}
+}
+
+// screenInfos describes the deck's screens, or all if the title is empty
+func (srv *Server) screenInfos(title string) []ScreenInfo {
+	srv.lock.RLock()
+	var screens []*Screen
+	for t, scrs := range srv.screens {
+		if title == "" || t == title {
+			screens = append(screens, scrs...)
+		}
+	}
+	srv.lock.RUnlock()
+
+	infos := make([]ScreenInfo, 0, len(screens))
+	for _, scr := range screens {
+		infos = append(infos, scr.Info(srv.get(scr.title).Content()))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Title != infos[j].Title {
+			return infos[i].Title < infos[j].Title
+		}
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// hasScreens returns true if the deck has screens with the role
+func (srv *Server) hasScreens(title, role string) bool {
+	srv.lock.RLock()
+	defer srv.lock.RUnlock()
+	for _, scr := range srv.screens[title] {
+		if scr.role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleScreens lists the connected screens, of a deck or all
+func (srv *Server) HandleScreens(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	title := req.Str("title").Def("").Get()
+	if req.Failed() {
+		return nil
+	}
+	return inout.JSON(srv.screenInfos(data.ResolveAliases(title)))
+}
+
+// screen event types
+const (
+	screenList         = "list" // sent first, with all screens
+	screenConnected    = "connected"
+	screenDisconnected = "disconnected"
+	screenStatus       = "status"
+)
+
+// ScreenEvent is sent to watchers when screens connect, disconnect or
+// report their status
+type ScreenEvent struct {
+	Type    string       `json:"type"`
+	Screens []ScreenInfo `json:"screens"`
+}
+
+// watcher gets the screen events
+type watcher struct {
+	conn    *websocket.Conn
+	updates chan []byte
+}
+
+// notify sends the event about the screen to all watchers
+func (srv *Server) notify(event string, scr *Screen) {
+	msg, err := json.Marshal(ScreenEvent{
+		Type:    event,
+		Screens: []ScreenInfo{scr.Info(srv.get(scr.title).Content())},
+	})
+	if err != nil {
+		return
+	}
+
+	srv.lock.RLock()
+	defer srv.lock.RUnlock()
+	for w := range srv.watchers {
+		select {
+		case w.updates <- msg:
+		default:
+			// too slow: disconnect it, it will reconnect and get the list
+			w.conn.Close()
+		}
+	}
+}
+
+// HandleScreensWatch streams the screen events on a websocket
+func (srv *Server) HandleScreensWatch(req *inout.Request) *inout.Reply {
+	conn, err := req.Upgrade()
+	if err != nil {
+		log.Error().Err(err).Msg("upgrading socket")
+		return inout.Error(http.StatusInternalServerError, "error connecting")
+	}
+
+	w := &watcher{conn: conn, updates: make(chan []byte, 32)}
+	srv.lock.Lock()
+	if srv.watchers == nil {
+		srv.watchers = map[*watcher]bool{}
+	}
+	srv.watchers[w] = true
+	srv.lock.Unlock()
+
+	// send the list: events sent before it are already included on it
+	if msg, err := json.Marshal(ScreenEvent{Type: screenList, Screens: srv.screenInfos("")}); err == nil {
+		select {
+		case w.updates <- msg:
+		default:
+		}
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		// discard anything sent, until the connection fails
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(pingPeriod)
+		defer func() {
+			ticker.Stop()
+			conn.Close()
+			srv.lock.Lock()
+			delete(srv.watchers, w)
+			srv.lock.Unlock()
+		}()
+
+		for {
+			var msg []byte
+			typ := websocket.TextMessage
+			select {
+			case msg = <-w.updates:
+			case <-ticker.C:
+				typ = websocket.PingMessage
+			case <-closed:
+				return
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(typ, msg); err != nil {
+				return
+			}
+		}
+	}()
+	return inout.Handled()
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/paupin2/slides/pkg/config"
+	"github.com/paupin2/slides/pkg/data"
+)
+
+func TestScreens(t *testing.T) {
+	if err := data.SaveUser(data.User{ID: "ana", Name: "Ana"}, "ana's password"); err != nil {
+		t.Fatal(err)
+	}
+	session, err := data.NewSession(data.User{ID: "ana"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := data.NewScreenToken("2022-06-05", "", data.SystemUser(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newServer()
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := inout.NewRequest(w, r)
+		req.Send(srv.Handle(req))
+	}))
+	defer hs.Close()
+	loggedIn := http.Header{"Cookie": {"session=" + session}}
+
+	list := func(header http.Header) (int, []ScreenInfo) {
+		r, _ := http.NewRequest(http.MethodGet, hs.URL+"/screens?title=2022-06-05", nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var reply struct {
+			Data []ScreenInfo `json:"data"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&reply)
+		return resp.StatusCode, reply.Data
+	}
+
+	// connect connects a screen through server-sent events, forwarded by
+	// a proxy
+	connect := func(forwardedFor string) *http.Response {
+		q := url.Values{"title": {"2022-06-05"}, "token": {token}}
+		r, _ := http.NewRequest(http.MethodGet, hs.URL+"/screen/events?"+q.Encode(), nil)
+		r.Header.Set("X-Forwarded-For", forwardedFor)
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readEvent(t, bufio.NewReader(resp.Body))
+		return resp
+	}
+
+	if status, _ := list(nil); status != http.StatusUnauthorized {
+		t.Errorf("expected 401 without logging in, got %d", status)
+	}
+	watchURL := "ws" + strings.TrimPrefix(hs.URL, "http") + "/screens/watch"
+	if _, resp, err := websocket.DefaultDialer.Dial(watchURL, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 watching without logging in, got %v", err)
+	}
+
+	watch, _, err := websocket.DefaultDialer.Dial(watchURL, loggedIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watch.Close()
+	nextEvent := func() ScreenEvent {
+		t.Helper()
+		_ = watch.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var ev ScreenEvent
+		if err := watch.ReadJSON(&ev); err != nil {
+			t.Fatal(err)
+		}
+		return ev
+	}
+	if ev := nextEvent(); ev.Type != screenList || len(ev.Screens) != 0 {
+		t.Errorf("bad first event: %+v", ev)
+	}
+
+	// without trusted proxies, X-Forwarded-For is ignored
+	spoofed := connect("203.0.113.9")
+	defer spoofed.Body.Close()
+	ev := nextEvent()
+	if ev.Type != screenConnected || len(ev.Screens) != 1 || !strings.HasPrefix(ev.Screens[0].Address, "127.0.0.1:") {
+		t.Errorf("bad connected event: %+v", ev)
+	}
+
+	// behind a trusted proxy, the address it saw is used
+	config.Config.TrustedProxies = []string{"127.0.0.0/8"}
+	defer func() { config.Config.TrustedProxies = nil }()
+	proxied := connect("10.9.9.9, 203.0.113.9")
+	if ev := nextEvent(); ev.Type != screenConnected || len(ev.Screens) != 1 || ev.Screens[0].Address != "203.0.113.9" {
+		t.Errorf("bad connected event behind a proxy: %+v", ev)
+	}
+
+	status, infos := list(loggedIn)
+	if status != http.StatusOK || len(infos) != 2 || infos[1].Address != "203.0.113.9" || infos[1].Transport != transportEvents {
+		t.Errorf("bad screens: %d %+v", status, infos)
+	}
+
+	proxied.Body.Close()
+	if ev := nextEvent(); ev.Type != screenDisconnected || len(ev.Screens) != 1 || ev.Screens[0].ID != infos[1].ID {
+		t.Errorf("bad disconnected event: %+v", ev)
+	}
+}
+
+func TestScreenLinkDisconnects(t *testing.T) {
+	session, err := data.NewSession(data.User{ID: "ana"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer()
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := inout.NewRequest(w, r)
+		req.Send(srv.Handle(req))
+	}))
+	t.Cleanup(hs.Close) // after the screens disconnect
+
+	// connect returns the events of a screen connected with a new link
+	connect := func(d time.Duration) (data.ScreenToken, *bufio.Reader) {
+		token, st, err := data.NewScreenToken("2022-06-12", "", data.SystemUser(), d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := url.Values{"title": {"2022-06-12"}, "token": {token}}
+		resp, err := http.Get(hs.URL + "/screen/events?" + q.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		events := bufio.NewReader(resp.Body)
+		readEvent(t, events)
+		return st, events
+	}
+
+	// closed waits for the screen's events to end
+	closed := func(events *bufio.Reader) bool {
+		done := make(chan bool)
+		go func() {
+			_, err := io.ReadAll(events)
+			done <- err == nil
+		}()
+		select {
+		case ok := <-done:
+			return ok
+		case <-time.After(2 * time.Second):
+			return false
+		}
+	}
+
+	revoked, events := connect(time.Hour)
+	_, kept := connect(time.Hour)
+	r, _ := http.NewRequest(http.MethodPost, hs.URL+"/screen/tokens/revoke?id="+strconv.Itoa(revoked.ID), nil)
+	r.Header.Set("Cookie", "session="+session)
+	if resp, err := http.DefaultClient.Do(r); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != http.StatusOK {
+		t.Fatalf("revoking: got %d", resp.StatusCode)
+	}
+	if !closed(events) {
+		t.Error("screen still connected after revoking its link")
+	}
+
+	_, events = connect(300 * time.Millisecond)
+	if !closed(events) {
+		t.Error("screen still connected after its link expired")
+	}
+
+	if infos := srv.screenInfos("2022-06-12"); len(infos) != 1 {
+		t.Errorf("expected only the screen with a valid link, got %+v", infos)
+	}
+	srv.show("2022-06-12", Presentation{Index: -1, Text: "still here"})
+	if _, msg := readEvent(t, kept); !strings.Contains(msg, "still here") {
+		t.Errorf("bad event: %s", msg)
+	}
+}
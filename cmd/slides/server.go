@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
@@ -8,8 +9,15 @@ import (
 
 	"github.com/paupin2/slides/cmd/slides/pkg/decks"
 	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/paupin2/slides/cmd/slides/pkg/reports"
 	"github.com/paupin2/slides/cmd/slides/pkg/songs"
+	"github.com/paupin2/slides/cmd/slides/pkg/tokens"
+	"github.com/paupin2/slides/cmd/slides/pkg/users"
+	"github.com/paupin2/slides/pkg/broadcast"
+	"github.com/paupin2/slides/pkg/config"
 	"github.com/paupin2/slides/pkg/data"
+	"github.com/paupin2/slides/pkg/obs"
+	"github.com/paupin2/slides/pkg/slides"
 	"github.com/rs/zerolog/log"
 )
 
@@ -19,40 +27,67 @@ type (
 	Server struct {
 		lock    sync.RWMutex
 		routes  map[string]map[string]handler
+		public  map[string]bool // paths that don't need a user to change things
+		private map[string]bool // GET paths that need a user
 		screens map[string][]*Screen
-		content map[string]string
+		// screen ids, and who gets screen events
+		lastScreenID int
+		watchers     map[*watcher]bool
+		content      map[string]Presentation
+		obs          *obs.Client // nil if not configured
+		broadcaster  broadcast.Broadcaster
 	}
 )
 
-func (srv *Server) get(title string) string {
+func (srv *Server) get(title string) Presentation {
 	srv.lock.RLock()
 	defer srv.lock.RUnlock()
-	return srv.content[title]
+	if p, found := srv.content[title]; found {
+		return p
+	}
+	return noPresentation
 }
 
-func (srv *Server) set(title, content string) {
+func (srv *Server) set(title string, p Presentation) {
 	srv.lock.Lock()
 	defer srv.lock.Unlock()
 	if srv.content == nil {
-		srv.content = make(map[string]string)
+		srv.content = make(map[string]Presentation)
 	}
 
-	srv.content[title] = content
+	srv.content[title] = p
 }
 
+// HandleShow shows free text on the deck's screens. If the text matches one
+// of the deck's slides, that becomes the current slide.
 func (srv *Server) HandleShow(req *inout.Request) *inout.Reply {
-	var data struct {
+	var input struct {
 		Title string `json:"title"`
 		Show  string `json:"show"`
 	}
 
-	if err := req.Read(&data); err != nil || data.Title == "" {
+	if err := req.Read(&input); err != nil {
+		return inout.Error(http.StatusBadRequest, "bad deck")
+	}
+	title, err := resolveTitle(input.Title)
+	if err != nil {
 		return inout.Error(http.StatusBadRequest, "bad deck")
 	}
 
+	p := Presentation{Index: -1, Text: input.Show}
+	if input.Show == "" {
+		// blank the screens, keeping the current slide
+		p = srv.get(title)
+		p.Blank = true
+	} else if deck, found := data.LoadDeck(title); found {
+		ss := slides.Parse(deck.Text)
+		p.Revision = deck.Revision
+		p.Index = indexOf(ss, input.Show)
+		p.Footer = footerOf(ss, p.Index, config.Config.CCLI, data.SongByID)
+	}
+
 	// set the content, send it to all screens
-	srv.set(data.Title, data.Show)
-	srv.Broadcast(data.Title, Content{data.Show})
+	srv.show(title, p)
 
 	return inout.OK()
 }
@@ -66,32 +101,76 @@ func handleGetVersion(req *inout.Request) *inout.Reply {
 func newServer() *Server {
 	srv := &Server{
 		screens: map[string][]*Screen{},
+		public:  map[string]bool{"/login": true},
+		private: map[string]bool{"/screens": true, "/screens/watch": true, "/screen/tokens": true, "/deck/edit": true, "/reports/ccli": true},
 		routes: map[string]map[string]handler{
 			http.MethodGet: {
 				"/version": handleGetVersion,
-
-				"/song":  songs.HandleGet,
-				"/songs": songs.HandleList,
-
-				"/deck":  decks.HandleGet,
-				"/decks": decks.HandleList,
+				"/me":      users.HandleMe,
+
+				"/song":              songs.HandleGet,
+				"/song/usage":        songs.HandleUsage,
+				"/song/arrangements": songs.HandleArrangements,
+				"/songs":             songs.HandleList,
+				"/songs/unused":      songs.HandleUnused,
+
+				"/deck":            decks.HandleGet,
+				"/deck/export.pdf": decks.HandleExportPDF,
+				"/deck/slides":     decks.HandleSlides,
+				"/deck/revisions":  decks.HandleRevisions,
+				"/deck/revision":   decks.HandleRevision,
+				"/deck/diff":       decks.HandleDiff,
+				"/deck/edit":       decks.HandleEdit,
+				"/decks":           decks.HandleList,
+
+				"/screen/tokens": tokens.HandleList,
+				"/reports/ccli":  reports.HandleCCLI,
 			},
 			http.MethodPost: {
-				"/song": songs.HandlePost,
+				"/login":  users.HandleLogin,
+				"/logout": users.HandleLogout,
+
+				"/song":              songs.HandlePost,
+				"/song/arrangements": songs.HandleArrangementPost,
+				"/deck/restore":      decks.HandleRestore,
+				"/decks/import":      decks.HandleImportPlans,
+
+				"/screen/tokens": tokens.HandleCreate,
 			},
 			http.MethodPut: {
-				"/song": songs.HandlePut,
-				"/deck": decks.HandlePut,
+				"/song":              songs.HandlePut,
+				"/song/arrangements": songs.HandleArrangementPut,
+				"/deck":              decks.HandlePut,
 			},
 			http.MethodDelete: {
-				"/deck": decks.HandleDelete,
-				"/song": songs.HandleDelete,
+				"/deck":              decks.HandleDelete,
+				"/song":              songs.HandleDelete,
+				"/song/arrangements": songs.HandleArrangementDelete,
 			},
 		},
 	}
+	srv.routes[http.MethodGet]["/show"] = srv.HandleShowGet
 	srv.routes[http.MethodPost]["/show"] = srv.HandleShow
+	srv.routes[http.MethodPost]["/show/next"] = srv.HandleShowNext
+	srv.routes[http.MethodPost]["/show/prev"] = srv.HandleShowPrev
+	srv.routes[http.MethodPost]["/show/goto"] = srv.HandleShowGoto
+	srv.routes[http.MethodPost]["/show/clear"] = srv.HandleShowClear
 	srv.routes[http.MethodGet]["/screen"] = srv.HandleScreen
-
+	srv.routes[http.MethodGet]["/screen/events"] = srv.HandleScreenEvents
+	srv.routes[http.MethodGet]["/screens"] = srv.HandleScreens
+	srv.routes[http.MethodGet]["/screens/watch"] = srv.HandleScreensWatch
+	srv.routes[http.MethodPost]["/screen/tokens/revoke"] = srv.HandleRevokeToken
+
+	srv.loadPresentations()
+	b, err := broadcast.New(context.Background(), config.Config.Broadcast, srv.deliver)
+	if err != nil {
+		log.Fatal().Err(err).Msg("starting broadcaster")
+	}
+	srv.broadcaster = b
+	if cfg := config.Config.OBS; cfg.Address != "" {
+		srv.obs = obs.New(cfg)
+		go srv.obs.Run(context.Background())
+	}
 	return srv
 }
 
@@ -130,11 +209,18 @@ func (s *Server) Route(r *http.Request, method string, expected ...any) bool {
 	return true
 }
 
-// Handle requests to the server
+// Handle requests to the server. Only logged-in users can change things.
 func (s *Server) Handle(req *inout.Request) *inout.Reply {
 	path := req.Path()
-	if handler := s.routes[req.Method()][path]; handler != nil {
-		return handler(req)
+	handler := s.routes[req.Method()][path]
+	if handler == nil {
+		return nil
+	}
+
+	if (req.Method() != http.MethodGet && !s.public[path]) || s.private[path] {
+		if _, ok := users.Current(req); !ok {
+			return inout.Error(http.StatusUnauthorized, "not logged in")
+		}
 	}
-	return nil
+	return handler(req)
 }
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/paupin2/slides/pkg/config"
+	"github.com/paupin2/slides/pkg/data"
+	"github.com/paupin2/slides/pkg/obs"
+	"github.com/paupin2/slides/pkg/slides"
+	"github.com/rs/zerolog/log"
+)
+
+// Presentation is what's being shown on a deck's screens
+type Presentation struct {
+	Revision int    `json:"revision"` // deck revision
+	Index    int    `json:"index"`    // slide index, or -1 if showing free text
+	Blank    bool   `json:"blank"`
+	Text     string `json:"text"`
+	Footer   string `json:"footer,omitempty"` // the song's attribution, if any
+}
+
+// noPresentation is used for decks which weren't shown yet
+var noPresentation = Presentation{Index: -1, Blank: true}
+
+// Content returns what the screens should show
+func (p Presentation) Content() Content {
+	if p.Blank {
+		return newContent("")
+	}
+	c := newContent(p.Text)
+	c.Footer = p.Footer
+	return c
+}
+
+// locate returns the index of the slide being shown on the slides,
+// or -1 if it's not there. If the deck was changed since, the slide is
+// located by its text.
+func (p Presentation) locate(deck data.Deck, ss []slides.Slide) int {
+	if p.Index >= 0 && p.Index < len(ss) && p.Revision == deck.Revision {
+		return p.Index
+	}
+	return indexOf(ss, p.Text)
+}
+
+// indexOf returns the index of the first slide with the text, or -1
+func indexOf(ss []slides.Slide, text string) int {
+	if text == "" {
+		return -1
+	}
+	for i, s := range ss {
+		if s.Text == text {
+			return i
+		}
+	}
+	return -1
+}
+
+// show sets the presentation, stores it and publishes it, so it reaches
+// the screens on every server instance
+func (srv *Server) show(title string, p Presentation) {
+	srv.set(title, p)
+	buf, err := json.Marshal(p)
+	if err != nil {
+		return
+	}
+	_ = data.SaveCurrent(title, string(buf))
+	if err := srv.broadcaster.Publish(context.Background(), title, buf); err != nil {
+		// at least update this instance's screens
+		log.Error().Err(err).Str("deck", title).Msg("publishing")
+		srv.deliver(title, buf)
+	}
+}
+
+// deliver sends a published presentation to this instance's screens
+func (srv *Server) deliver(title string, msg []byte) {
+	var p Presentation
+	if err := json.Unmarshal(msg, &p); err != nil {
+		log.Warn().Err(err).Str("deck", title).Msg("bad presentation")
+		return
+	}
+
+	srv.set(title, p)
+	srv.Broadcast(title, roleAudience, p.Content())
+	if srv.hasScreens(title, roleStage) {
+		srv.Broadcast(title, roleStage, srv.stage(title, p))
+	}
+	if srv.obs != nil {
+		text := strings.TrimPrefix(p.Content().Text, "_\n") // no subtitles mode
+		srv.obs.Show(title, obs.State{Text: text, Blank: p.Blank})
+	}
+}
+
+// loadPresentations restores what was being shown before a restart
+func (srv *Server) loadPresentations() {
+	for title, current := range data.LoadCurrent() {
+		var p Presentation
+		if err := json.Unmarshal([]byte(current), &p); err != nil {
+			log.Warn().Err(err).Str("deck", title).Msg("bad current")
+			continue
+		}
+		srv.set(title, p)
+	}
+}
+
+// present shows the slide returned by `move`, which gets the index of the
+// current slide (or -1), and the number of slides on the deck.
+func (srv *Server) present(req *inout.Request, move func(current, count int) int) *inout.Reply {
+	req.IsAjax()
+	title := req.Str("title").Get()
+	if req.Failed() {
+		return nil
+	}
+
+	deck, found := data.LoadDeck(title)
+	if !found {
+		return inout.Error(http.StatusNotFound, "not found")
+	}
+
+	ss := slides.Parse(deck.Text)
+	current := srv.get(deck.Title).locate(deck, ss)
+	index := move(current, len(ss))
+	if index < 0 || index >= len(ss) {
+		return inout.Error(http.StatusBadRequest, "bad index")
+	}
+
+	p := Presentation{Revision: deck.Revision, Index: index, Text: ss[index].Text}
+	p.Footer = footerOf(ss, index, config.Config.CCLI, data.SongByID)
+	srv.show(deck.Title, p)
+	return inout.JSON(p)
+}
+
+func (srv *Server) HandleShowNext(req *inout.Request) *inout.Reply {
+	return srv.present(req, func(current, count int) int {
+		if current+1 >= count {
+			return count - 1 // stay on the last slide
+		}
+		return current + 1
+	})
+}
+
+func (srv *Server) HandleShowPrev(req *inout.Request) *inout.Reply {
+	return srv.present(req, func(current, count int) int {
+		if current <= 0 {
+			return 0 // stay on the first slide
+		}
+		return current - 1
+	})
+}
+
+func (srv *Server) HandleShowGoto(req *inout.Request) *inout.Reply {
+	index := req.Int("index").Get()
+	return srv.present(req, func(_, _ int) int {
+		return index
+	})
+}
+
+// resolveTitle returns the title of the deck, resolving aliases like
+// "sunday", and an error if it's not a valid title
+func resolveTitle(title string) (string, error) {
+	title = data.ResolveAliases(title)
+	return title, data.CheckTitle(title)
+}
+
+// HandleShowClear blanks the screens, keeping the current slide
+func (srv *Server) HandleShowClear(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	title := req.Str("title").Get()
+	if req.Failed() {
+		return nil
+	}
+	title, err := resolveTitle(title)
+	if err != nil {
+		return inout.Error(http.StatusBadRequest, "bad title")
+	}
+
+	p := srv.get(title)
+	p.Blank = true
+	srv.show(title, p)
+	return inout.JSON(p)
+}
+
+// HandleShowGet returns the deck's current presentation
+func (srv *Server) HandleShowGet(req *inout.Request) *inout.Reply {
+	req.IsAjax()
+	title := req.Str("title").Get()
+	if req.Failed() {
+		return nil
+	}
+	title, err := resolveTitle(title)
+	if err != nil {
+		return inout.Error(http.StatusBadRequest, "bad title")
+	}
+
+	return inout.JSON(srv.get(title))
+}
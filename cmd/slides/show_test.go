@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/paupin2/slides/cmd/slides/pkg/inout"
+	"github.com/paupin2/slides/pkg/data"
+)
+
+func TestShowAliases(t *testing.T) {
+	if err := data.SaveUser(data.User{ID: "ana", Name: "Ana"}, "ana's password"); err != nil {
+		t.Fatal(err)
+	}
+	session, err := data.NewSession(data.User{ID: "ana"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newServer()
+	hs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := inout.NewRequest(w, r)
+		req.Send(srv.Handle(req))
+	}))
+	defer hs.Close()
+	post := func(path, body string) int {
+		t.Helper()
+		r, _ := http.NewRequest(http.MethodPost, hs.URL+path, strings.NewReader(body))
+		r.Header.Set("Cookie", "session="+session)
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// aliases are shown on the deck they stand for
+	sunday := data.ResolveAliases("sunday")
+	if status := post("/show", `{"title":"sunday","show":"Good morning"}`); status != http.StatusOK {
+		t.Fatalf("showing: got %d", status)
+	}
+	if p := srv.get(sunday); p.Text != "Good morning" || p.Blank {
+		t.Errorf("bad presentation of %s: %+v", sunday, p)
+	}
+	if status := post("/show/clear?title=Sunday", ""); status != http.StatusOK {
+		t.Fatalf("clearing: got %d", status)
+	}
+	if p := srv.get(sunday); p.Text != "Good morning" || !p.Blank {
+		t.Errorf("bad cleared presentation of %s: %+v", sunday, p)
+	}
+
+	// bad titles aren't shown anywhere
+	for _, path := range []string{"/show", "/show/clear?title=a/b"} {
+		if status := post(path, `{"title":"a/b","show":"Good morning"}`); status != http.StatusBadRequest {
+			t.Errorf("%s with a bad title: expected 400, got %d", path, status)
+		}
+	}
+	srv.lock.RLock()
+	defer srv.lock.RUnlock()
+	if _, found := srv.content["a/b"]; found {
+		t.Error("a bad title was shown")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/paupin2/slides/pkg/data"
+	"github.com/paupin2/slides/pkg/slides"
+)
+
+// screen roles
+const (
+	roleAudience = "audience" // only the lyrics; the default
+	roleStage    = "stage"    // for those on stage: also the next slide, section and chords
+)
+
+// validRole returns true if screens can connect with the role
+func validRole(role string) bool {
+	return role == roleAudience || role == roleStage
+}
+
+// StageSlide is a slide as shown on stage screens
+type StageSlide struct {
+	Text    string `json:"text"`
+	Section string `json:"section,omitempty"`
+}
+
+// Stage is what stage screens show. Unlike audience screens, they keep
+// showing the slide when the screens are blank.
+type Stage struct {
+	Version int         `json:"v"`
+	Type    string      `json:"type"`
+	Text    string      `json:"text"`
+	Hash    string      `json:"hash"` // of the audience's content, reported back the same way
+	Blank   bool        `json:"blank"`
+	Index   int         `json:"index"` // slide index, or -1 if showing free text
+	Count   int         `json:"count"` // number of slides on the deck
+	Song    string      `json:"song,omitempty"`
+	Section string      `json:"section,omitempty"`
+	Chords  string      `json:"chords,omitempty"` // the slide's source, if it has chords
+	Next    *StageSlide `json:"next,omitempty"`
+}
+
+// newStage builds what stage screens show for the presentation, using the
+// deck's slides. `songSource` returns the text of a song, to find the
+// chords when the deck was cleaned from them.
+func newStage(p Presentation, deck data.Deck, songSource func(id int) string) Stage {
+	ss := slides.Parse(deck.Text)
+	st := Stage{
+		Version: ProtocolVersion,
+		Type:    msgStage,
+		Text:    p.Text,
+		Hash:    p.Content().Hash,
+		Blank:   p.Blank,
+		Index:   p.locate(deck, ss),
+		Count:   len(ss),
+	}
+	if st.Index < 0 {
+		return st
+	}
+
+	var songID int
+	st.Song, songID, st.Section = sectionOf(ss, st.Index)
+	if next := st.Index + 1; next < len(ss) {
+		_, _, section := sectionOf(ss, next)
+		st.Next = &StageSlide{Text: ss[next].Text, Section: section}
+	}
+
+	// use the deck's chords, or else the song's
+	if source := sourceOf(deck.Text, ss[st.Index]); hasChords(source) {
+		st.Chords = source
+	} else if songID != 0 && songSource != nil {
+		song := songSource(songID)
+		songSlides := slides.Parse(song)
+		if i := indexOf(songSlides, ss[st.Index].Text); i >= 0 {
+			if source := sourceOf(song, songSlides[i]); hasChords(source) {
+				st.Chords = source
+			}
+		}
+	}
+	return st
+}
+
+// sectionOf returns the song and section the slide is on, looking at its
+// headers and the ones before it
+func sectionOf(ss []slides.Slide, index int) (song string, songID int, section string) {
+	for _, s := range ss[:index+1] {
+		for _, h := range s.Headers {
+			if title, id, found := slides.SongRef(h); found {
+				song, songID, section = title, id, ""
+			} else {
+				section = h
+			}
+		}
+	}
+	return song, songID, section
+}
+
+// sourceOf returns the slide's lines on the source, including those that
+// aren't shown, like chords. The titles and empty lines around it are
+// left out.
+func sourceOf(source string, s slides.Slide) string {
+	runes := []rune(source)
+	if s.Start < 0 || s.Start > s.End || s.End > len(runes) {
+		return ""
+	}
+
+	lines := strings.Split(string(runes[s.Start:s.End]), "\n")
+	skip := func(line string) bool {
+		line = slides.CleanLine(line)
+		_, isTitle := slides.Title(line)
+		return line == "" || isTitle
+	}
+	for len(lines) > 0 && skip(lines[0]) {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && skip(lines[len(lines)-1]) {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// hasChords returns true if any of the lines has only chords
+func hasChords(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if slides.IsChordLine(slides.CleanLine(line)) {
+			return true
+		}
+	}
+	return false
+}
+
+// songSource returns the text of the song, or an empty string
+func songSource(id int) string {
+	if song := data.SongByID(id); song != nil {
+		return song.Content
+	}
+	return ""
+}
+
+// stage returns what the deck's stage screens should show
+func (srv *Server) stage(title string, p Presentation) Stage {
+	deck, _ := data.LoadDeck(title)
+	return newStage(p, deck, songSource)
+}
+
+// payload returns what the screen should show for the presentation
+func (srv *Server) payload(scr *Screen, p Presentation) any {
+	if scr.role == roleStage {
+		return srv.stage(scr.title, p)
+	}
+	return p.Content()
+}
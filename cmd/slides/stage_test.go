@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/paupin2/slides/pkg/data"
+)
+
+func TestStage(t *testing.T) {
+	deck := data.Deck{Revision: 3, Text: "# Welcome\n\nGood morning\n\n" +
+		"# Amazing Grace (@12)\nVerse 1\nAmazing grace\nhow sweet\n\nChorus\nMy chains\nare gone\n"}
+	song := "Verse 1\nG        C\nAmazing grace\n    G\nhow sweet\n\nChorus\nMy chains\nare gone\n"
+	songSource := func(id int) string {
+		if id != 12 {
+			t.Errorf("unexpected song %d", id)
+		}
+		return song
+	}
+
+	st := newStage(Presentation{Revision: 3, Index: 1, Text: "Amazing grace\nhow sweet"}, deck, songSource)
+	if st.Type != msgStage || st.Index != 1 || st.Count != 3 || st.Blank {
+		t.Errorf("bad stage: %+v", st)
+	}
+	if st.Song != "Amazing Grace" || st.Section != "Verse 1" {
+		t.Errorf("bad section: %q %q", st.Song, st.Section)
+	}
+	if st.Next == nil || st.Next.Text != "My chains\nare gone" || st.Next.Section != "Chorus" {
+		t.Errorf("bad next slide: %+v", st.Next)
+	}
+	if want := "G        C\nAmazing grace\n    G\nhow sweet"; st.Chords != want {
+		t.Errorf("bad chords: %q, want %q", st.Chords, want)
+	}
+	if st.Hash != contentHash(st.Text) {
+		t.Errorf("stage hash should match the audience's")
+	}
+
+	// blank: keep showing the slide, with the audience's hash
+	st = newStage(Presentation{Revision: 3, Index: 2, Blank: true, Text: "My chains\nare gone"}, deck, songSource)
+	if st.Text != "My chains\nare gone" || !st.Blank || st.Hash != contentHash("") {
+		t.Errorf("bad blank stage: %+v", st)
+	}
+	if st.Section != "Chorus" || st.Next != nil || st.Chords != "" {
+		t.Errorf("bad last slide: %+v", st)
+	}
+
+	// the deck's own chords are used first
+	deck.Text = "Verse\nD\nOne line\n"
+	st = newStage(Presentation{Revision: 3, Index: 0, Text: "One line"}, deck, nil)
+	if st.Chords != "D\nOne line" || st.Section != "Verse" || st.Song != "" {
+		t.Errorf("bad deck chords: %+v", st)
+	}
+
+	// free text
+	st = newStage(Presentation{Index: -1, Text: "Announcements"}, deck, nil)
+	if st.Index != -1 || st.Text != "Announcements" || st.Next != nil {
+		t.Errorf("bad free text: %+v", st)
+	}
+}
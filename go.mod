@@ -8,3 +8,18 @@ require (
 	github.com/rs/zerolog v1.26.1
 	gopkg.in/yaml.v2 v2.4.0
 )
+
+require golang.org/x/crypto v0.17.0
+
+require github.com/go-pdf/fpdf v0.6.0
+
+require github.com/redis/go-redis/v9 v9.5.1
+
+require github.com/alicebob/miniredis/v2 v2.31.1
+
+require (
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/yuin/gopher-lua v1.1.0 // indirect
+)
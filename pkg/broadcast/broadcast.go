@@ -0,0 +1,51 @@
+// Package broadcast sends what's shown on a deck to every server instance,
+// so that screens connected to any of them are updated. Without a shared
+// backend only this instance is reached.
+package broadcast
+
+import (
+	"context"
+
+	"github.com/paupin2/slides/pkg/config"
+)
+
+// Handler gets the messages published about a deck
+type Handler func(title string, msg []byte)
+
+// Broadcaster delivers the published messages to the handler of every
+// server instance, including the one publishing them
+type Broadcaster interface {
+	// Publish sends the message about the deck
+	Publish(ctx context.Context, title string, msg []byte) error
+	// Close stops delivering messages
+	Close() error
+}
+
+// New returns the broadcaster in the configuration, delivering messages
+// to the handler
+func New(ctx context.Context, cfg config.Broadcast, h Handler) (Broadcaster, error) {
+	if cfg.Redis != "" {
+		return NewRedis(ctx, cfg, h)
+	}
+	return NewMemory(h), nil
+}
+
+// Memory delivers messages only to this instance
+type Memory struct {
+	handler Handler
+}
+
+// NewMemory returns a broadcaster delivering messages to the handler
+func NewMemory(h Handler) *Memory {
+	return &Memory{handler: h}
+}
+
+// Publish delivers the message right away
+func (m *Memory) Publish(_ context.Context, title string, msg []byte) error {
+	m.handler(title, msg)
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,101 @@
+package broadcast
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/paupin2/slides/pkg/config"
+)
+
+type received struct {
+	title string
+	msg   string
+}
+
+func collect() (Handler, chan received) {
+	ch := make(chan received, 10)
+	return func(title string, msg []byte) {
+		ch <- received{title, string(msg)}
+	}, ch
+}
+
+func expect(t *testing.T, ch chan received, want received) {
+	t.Helper()
+	select {
+	case got := <-ch:
+		if got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("timed out waiting for %+v", want)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	h, ch := collect()
+	b, err := New(context.Background(), config.Broadcast{}, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.(*Memory); !ok {
+		t.Fatalf("expected the in-memory broadcaster, got %T", b)
+	}
+	if err := b.Publish(context.Background(), "deck", []byte(`{"text":"hi"}`)); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, ch, received{"deck", `{"text":"hi"}`})
+}
+
+func TestRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	cfg := config.Broadcast{Redis: mr.Addr()}
+
+	// two instances: what's published on one reaches both
+	h1, ch1 := collect()
+	b1, err := New(ctx, cfg, h1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b1.Close()
+	h2, ch2 := collect()
+	b2, err := New(ctx, cfg, h2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b2.Close()
+
+	if err := b1.Publish(ctx, "deck", []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, ch1, received{"deck", "one"})
+	expect(t, ch2, received{"deck", "one"})
+
+	if err := b2.Publish(ctx, "other", []byte("two")); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, ch1, received{"other", "two"})
+	expect(t, ch2, received{"other", "two"})
+
+	// other channels aren't received
+	other, err := New(ctx, config.Broadcast{Redis: mr.Addr(), Channel: "elsewhere"}, h1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if err := other.Publish(ctx, "deck", []byte("three")); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, ch1, received{"deck", "three"})
+	select {
+	case got := <-ch2:
+		t.Errorf("unexpected message %+v", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err := New(ctx, config.Broadcast{Redis: "127.0.0.1:1"}, h1); err == nil {
+		t.Error("expected an error connecting to a bad address")
+	}
+}
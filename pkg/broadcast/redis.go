@@ -0,0 +1,88 @@
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/paupin2/slides/pkg/config"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultChannel is the Redis channel used when none is configured
+const DefaultChannel = "slides"
+
+// envelope is what's published on the channel
+type envelope struct {
+	Title string `json:"title"`
+	Msg   []byte `json:"msg"`
+}
+
+// Redis delivers messages through Redis pub/sub, to every instance
+// subscribed to the channel. Messages published while an instance is
+// disconnected are lost: its screens are updated on the next one.
+type Redis struct {
+	client  *redis.Client
+	pubsub  *redis.PubSub
+	channel string
+	done    chan struct{}
+}
+
+// NewRedis subscribes to the channel, and delivers its messages to the
+// handler until closed
+func NewRedis(ctx context.Context, cfg config.Broadcast, h Handler) (*Redis, error) {
+	r := &Redis{
+		client: redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis,
+			Password: cfg.Password,
+			DB:       cfg.DB,
+		}),
+		channel: cfg.Channel,
+		done:    make(chan struct{}),
+	}
+	if r.channel == "" {
+		r.channel = DefaultChannel
+	}
+
+	// wait for the subscription, so nothing published after is missed
+	r.pubsub = r.client.Subscribe(ctx, r.channel)
+	if _, err := r.pubsub.Receive(ctx); err != nil {
+		r.pubsub.Close()
+		r.client.Close()
+		return nil, fmt.Errorf("subscribing to %s: %w", r.channel, err)
+	}
+
+	go func() {
+		defer close(r.done)
+		for m := range r.pubsub.Channel() {
+			var env envelope
+			if err := json.Unmarshal([]byte(m.Payload), &env); err != nil {
+				log.Warn().Err(err).Str("channel", r.channel).Msg("bad broadcast message")
+				continue
+			}
+			h(env.Title, env.Msg)
+		}
+	}()
+	log.Info().Str("address", cfg.Redis).Str("channel", r.channel).Msg("broadcasting through redis")
+	return r, nil
+}
+
+// Publish sends the message to every subscribed instance
+func (r *Redis) Publish(ctx context.Context, title string, msg []byte) error {
+	payload, err := json.Marshal(envelope{Title: title, Msg: msg})
+	if err != nil {
+		return err
+	}
+	return r.client.Publish(ctx, r.channel, payload).Err()
+}
+
+// Close unsubscribes, waiting for the messages received to be delivered
+func (r *Redis) Close() error {
+	err := r.pubsub.Close()
+	<-r.done
+	if cerr := r.client.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
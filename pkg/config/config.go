@@ -15,19 +15,52 @@ var (
 	configPath = flag.String("config", "config.yaml", "Path to configuration file")
 )
 
+// OBS has the settings to control OBS Studio, through obs-websocket
+type OBS struct {
+	Address      string // like ws://localhost:4455, or empty to disable it
+	Password     string
+	Deck         string // only follow this deck (default: any deck)
+	TextSource   string // text source to show the slides on
+	Scene        string // scene with the LyricsSource (default: the current one)
+	LyricsSource string // source to hide when the screen is cleared,
+	LyricsScene  string // or scene to switch to when showing slides,
+	ClearScene   string // and when the screen is cleared
+}
+
+// Broadcast has the settings to share what's shown between server
+// instances. Without a Redis address, only this instance's screens are
+// updated.
+type Broadcast struct {
+	Redis    string // like localhost:6379
+	Password string
+	DB       int
+	Channel  string // pub/sub channel (default: "slides")
+}
+
+// CCLI has the church's CCLI licence, shown with the songs' lyrics
+type CCLI struct {
+	Licence string // licence number
+	Footer  string // which slides of a song show its footer: "first-last" (the default), "every" or "none"
+}
+
 // Struct contains the data structure read from config.yaml
 type Struct struct {
-	Address string
-	BaseURL string
-	Path    struct {
+	Address        string
+	BaseURL        string
+	TrustedProxies []string // whose X-Forwarded-For is used, as addresses or CIDR ranges
+	Path           struct {
 		Db      string
 		Log     string
 		logfile io.ReadCloser
 	}
 	PlanningCenter struct {
-		AppID  string
-		Secret string
+		AppID       string
+		Secret      string
+		ServiceType string // id of the service type to import plans from
 	}
+	OBS       OBS
+	Broadcast Broadcast
+	CCLI      CCLI
 }
 
 var Config Struct
@@ -0,0 +1,211 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var errBadName = errors.New("name is empty")
+
+// Arrangement is a version of a song, like a short one, or one with a key
+// change and an extra bridge. The song's own content is used when no
+// arrangement is chosen.
+type Arrangement struct {
+	ID         int       `json:"id"`
+	SongID     int       `json:"song_id"`
+	ExternalID string    `json:"-"`
+	Name       string    `json:"name"`
+	Key        string    `json:"key,omitempty"`
+	Tempo      int       `json:"tempo,omitempty"`
+	Sequence   []string  `json:"sequence,omitempty"` // section names, in order
+	Content    string    `json:"text"`
+	Imported   bool      `json:"imported,omitempty"`
+	Modified   time.Time `json:"modified"`
+}
+
+// Check returns an error if the arrangement can't be saved
+func (a Arrangement) Check() error {
+	if strings.TrimSpace(a.Name) == "" {
+		return errBadName
+	} else if strings.TrimSpace(a.Content) == "" {
+		return errBadContent
+	}
+	return nil
+}
+
+// joinSequence stores the section names, which can't have commas
+func joinSequence(sequence []string) string {
+	var list []string
+	for _, s := range sequence {
+		if s = strings.TrimSpace(strings.ReplaceAll(s, ",", " ")); s != "" {
+			list = append(list, s)
+		}
+	}
+	return strings.Join(list, ",")
+}
+
+func splitSequence(sequence string) []string {
+	if sequence == "" {
+		return nil
+	}
+	return strings.Split(sequence, ",")
+}
+
+func queryArrangements(whereetc string, args ...interface{}) []Arrangement {
+	query := `
+		select
+			id, song_id, coalesce(external_id, ''), name, coalesce(musical_key, ''),
+			coalesce(tempo, 0), coalesce(sequence, ''), content, modified
+		from song_arrangements
+	` + whereetc
+
+	rows, err := runQuery(query, args...)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	list := []Arrangement{}
+	for rows.Next() {
+		var (
+			a        Arrangement
+			sequence string
+		)
+		err := rows.Scan(
+			&a.ID, &a.SongID, &a.ExternalID, &a.Name, &a.Key,
+			&a.Tempo, &sequence, &a.Content, &a.Modified,
+		)
+		if err != nil {
+			log.Err(err).Msg("scanning arrangement")
+			return nil
+		}
+		a.Sequence = splitSequence(sequence)
+		a.Imported = a.ExternalID != ""
+		list = append(list, a)
+	}
+	return list
+}
+
+// SongArrangements returns the song's arrangements, in the order they were
+// added
+func SongArrangements(songID int) []Arrangement {
+	return queryArrangements(`where song_id = ? order by id`, songID)
+}
+
+// ArrangementByID returns the arrangement, or nil if not found
+func ArrangementByID(id int) *Arrangement {
+	if list := queryArrangements(`where id = ?`, id); len(list) == 1 {
+		return &list[0]
+	}
+	return nil
+}
+
+// Save inserts or updates the arrangement. It returns ErrNotFound if the
+// song, or the arrangement being updated, doesn't exist.
+func (a *Arrangement) Save() error {
+	err := withTx(func(tx *sql.Tx) error {
+		var found int
+		if err := tx.QueryRow(`select count(*) from songs where rowid = ?`, a.SongID).Scan(&found); err != nil {
+			return err
+		} else if found == 0 {
+			return ErrNotFound
+		}
+		return a.save(tx)
+	})
+	switch err {
+	case nil:
+		log.Info().Int("id", a.ID).Int("song", a.SongID).Msg("saved arrangement")
+		return nil
+	case ErrNotFound:
+		return err
+	default:
+		log.Err(err).Int("id", a.ID).Int("song", a.SongID).Msg("saving arrangement")
+		return errCouldNotSave
+	}
+}
+
+func (a *Arrangement) save(tx *sql.Tx) error {
+	a.Modified = time.Now().UTC()
+	var externalID interface{}
+	if a.ExternalID != "" {
+		externalID = a.ExternalID
+	}
+
+	if a.ID == 0 {
+		res, err := tx.Exec(`
+			insert into song_arrangements (song_id, external_id, name, musical_key, tempo, sequence, content, modified)
+			values (?, ?, ?, ?, ?, ?, ?, ?)
+		`, a.SongID, externalID, a.Name, a.Key, a.Tempo, joinSequence(a.Sequence), a.Content, a.Modified)
+		if err != nil {
+			return err
+		}
+		id, _ := res.LastInsertId()
+		a.ID = int(id)
+		return nil
+	}
+
+	res, err := tx.Exec(`
+		update song_arrangements
+		set name = ?, musical_key = ?, tempo = ?, sequence = ?, content = ?, modified = ?
+		where id = ? and song_id = ?
+	`, a.Name, a.Key, a.Tempo, joinSequence(a.Sequence), a.Content, a.Modified, a.ID, a.SongID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes the arrangement
+func (a *Arrangement) Delete() error {
+	res, err := execQuery(`delete from song_arrangements where id = ?`, a.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	log.Info().Int("id", a.ID).Int("song", a.SongID).Msg("deleted arrangement")
+	return nil
+}
+
+// SaveImportedArrangements replaces the song's imported arrangements with
+// the ones given, matching them by their external id. Arrangements added
+// locally are kept.
+func SaveImportedArrangements(songID int, list []Arrangement) error {
+	err := withTx(func(tx *sql.Tx) error {
+		keep := []interface{}{songID}
+		for i := range list {
+			a := &list[i]
+			a.ID, a.SongID = 0, songID
+			err := tx.QueryRow(`
+				select id from song_arrangements where song_id = ? and external_id = ?
+			`, songID, a.ExternalID).Scan(&a.ID)
+			if err != nil && err != sql.ErrNoRows {
+				return err
+			}
+			if err := a.save(tx); err != nil {
+				return err
+			}
+			keep = append(keep, a.ID)
+		}
+
+		_, err := tx.Exec(`
+			delete from song_arrangements
+			where song_id = ? and external_id is not null
+			and id not in (0`+strings.Repeat(", ?", len(keep)-1)+`)
+		`, keep...)
+		return err
+	})
+	if err != nil {
+		log.Err(err).Int("song", songID).Msg("saving imported arrangements")
+		return errCouldNotSave
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package data
+
+import "testing"
+
+func TestArrangements(t *testing.T) {
+	openTestDB(t)
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	song := Song{Title: "Grace", Content: "la la"}
+	if !song.Save() {
+		t.Fatal("could not save song")
+	}
+
+	a := Arrangement{SongID: song.RowID, Name: "Short", Key: "G", Sequence: []string{"Verse 1", "Chorus"}, Content: "la"}
+	if err := a.Save(); err != nil || a.ID == 0 {
+		t.Fatalf("could not save arrangement: %v", err)
+	}
+	missing := Arrangement{SongID: song.RowID + 1, Name: "Long", Content: "la"}
+	if err := missing.Save(); err != ErrNotFound {
+		t.Errorf("saved an arrangement for a missing song: %v", err)
+	}
+
+	a.Name, a.Tempo = "Short (fast)", 120
+	if err := a.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if found := ArrangementByID(a.ID); found == nil || found.Name != "Short (fast)" || found.Tempo != 120 || len(found.Sequence) != 2 || found.Sequence[1] != "Chorus" {
+		t.Errorf("bad arrangement: %+v", found)
+	}
+
+	// importing replaces only the imported arrangements
+	imported := []Arrangement{
+		{ExternalID: "pc:1", Name: "Default", Content: "one"},
+		{ExternalID: "pc:2", Name: "Key change", Content: "two"},
+	}
+	if err := SaveImportedArrangements(song.RowID, imported); err != nil {
+		t.Fatal(err)
+	}
+	first := imported[0].ID
+	imported = []Arrangement{{ExternalID: "pc:1", Name: "Default", Content: "one, again"}}
+	if err := SaveImportedArrangements(song.RowID, imported); err != nil {
+		t.Fatal(err)
+	}
+	list := SongArrangements(song.RowID)
+	if len(list) != 2 || list[0].ID != a.ID || list[1].ID != first || list[1].Content != "one, again" || !list[1].Imported {
+		t.Errorf("bad arrangements after importing: %+v", list)
+	}
+
+	if err := a.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Delete(); err != ErrNotFound {
+		t.Errorf("deleted twice: %v", err)
+	}
+
+	// deleting the song deletes its arrangements
+	if err := song.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if list := SongArrangements(song.RowID); len(list) != 0 {
+		t.Errorf("arrangements left after deleting the song: %+v", list)
+	}
+}
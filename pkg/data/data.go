@@ -2,7 +2,6 @@ package data
 
 import (
 	"database/sql"
-	_ "embed"
 	"errors"
 	"flag"
 	"math/rand"
@@ -23,9 +22,6 @@ const (
 var (
 	db *sql.DB
 
-	//go:embed "create.sql"
-	sqlCreate string
-
 	systemUser = User{ID: SystemUserID, Name: "System"}
 )
 
@@ -47,7 +43,22 @@ func execQuery(query string, args ...interface{}) (sql.Result, error) {
 	return res, err
 }
 
-func Connect() {
+// withTx runs fn on a transaction, which is committed if fn succeeds
+func withTx(fn func(tx *sql.Tx) error) error {
+	Connect()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Open opens the database, without applying any migrations
+func Open() {
 	if db != nil {
 		return
 	}
@@ -56,9 +67,6 @@ func Connect() {
 	if path == "" {
 		flag.Usage()
 		os.Exit(1)
-
-	} else if sqlCreate == "" {
-		log.Fatal().Msg("no/bad creation SQL")
 	}
 
 	var err error
@@ -67,11 +75,20 @@ func Connect() {
 		log.Fatal().Err(err).Msg("opening db")
 	}
 
-	if _, err = execQuery(sqlCreate); err != nil {
-		log.Fatal().Msg("could not create db")
+	log.Info().Str("db", path).Msg("connected")
+}
+
+// Connect opens the database, and applies any pending migrations
+func Connect() {
+	if db != nil {
+		return
 	}
 
-	log.Info().Str("db", path).Msg("connected")
+	Open()
+	if _, err := Migrate(); err != nil {
+		log.Fatal().Err(err).Msg("could not migrate db")
+	}
+	ensureSearchIndex()
 }
 
 const (
@@ -175,7 +192,7 @@ func SystemUser() User {
 }
 
 func internalLoadUsers(includeSystem bool) (map[string]User, error) {
-	rows, err := runQuery(`select id, name from users`)
+	rows, err := runQuery(`select username, name from users`)
 	if err != nil {
 		return nil, err
 	}
@@ -1,14 +1,13 @@
 package data
 
 import (
+	"database/sql"
 	"errors"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
-	"regexp"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +18,7 @@ import (
 type Deck struct {
 	Title    string    `json:"title"`
 	Text     string    `json:"text"`
+	Revision int       `json:"revision"`
 	Creator  User      `json:"creator"`
 	LastMod  User      `json:"last_mod"`
 	Created  time.Time `json:"created"`
@@ -29,13 +29,36 @@ func (deck *Deck) Before(other *Deck) bool {
 	return titleBefore(deck.Title, other.Title)
 }
 
-var errCouldNotSave = errors.New("could not save, try again later")
+var (
+	errCouldNotSave = errors.New("could not save, try again later")
+
+	// ErrConflict is returned when saving something that was changed since
+	// it was loaded
+	ErrConflict = errors.New("changed since it was loaded")
+)
 
 func (d Deck) Valid() bool {
 	return CheckTitle(d.Title) == nil
 }
 
-func (d Deck) Save() error {
+// Save inserts or updates the deck. If its text changed, it's kept as a new
+// revision, and the deck's Revision is updated.
+func (d *Deck) Save() error {
+	return d.save(-1)
+}
+
+// SaveIf saves the deck only if it's still at the revision (0 if it
+// shouldn't exist), and returns ErrConflict otherwise
+func (d *Deck) SaveIf(revision int) error {
+	if revision < 0 {
+		return ErrConflict
+	}
+	return d.save(revision)
+}
+
+// save saves the deck, checking the current revision if `expected` isn't
+// negative
+func (d *Deck) save(expected int) error {
 	if err := CheckTitle(d.Title); err != nil {
 		return err
 	}
@@ -53,35 +76,84 @@ func (d Deck) Save() error {
 		d.LastMod = SystemUser()
 	}
 
-	_, err := execQuery(`
-		insert into decks (title, text, creator, lastmod, created, modified)
-		values (?, ?, ?, ?, ?, ?)
-		on conflict(title)
-		do update set
-			text = excluded.text,
-			creator = excluded.creator,
-			lastmod = excluded.lastmod,
-			created = excluded.created,
-			modified = excluded.modified;
-	`,
-		d.Title, d.Text,
-		d.Creator.ID, d.LastMod.ID,
-		d.Created, d.Modified,
-	)
-	if err != nil {
+	err := withTx(func(tx *sql.Tx) error {
+		var (
+			revision int
+			text     *string
+		)
+		err := tx.QueryRow(`select revision, text from decks where title = ?`, d.Title).Scan(&revision, &text)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if expected >= 0 && revision != expected {
+			return ErrConflict
+		}
+
+		if err == sql.ErrNoRows || text == nil || *text != d.Text {
+			// new revision; numbers aren't reused if the deck was deleted
+			err = tx.QueryRow(`
+				select coalesce(max(revision), 0) + 1
+				from deck_revisions
+				where title = ?
+			`, d.Title).Scan(&revision)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`
+				insert into deck_revisions (title, revision, text, author, created)
+				values (?, ?, ?, ?, ?);
+			`, d.Title, revision, d.Text, d.LastMod.ID, d.Modified)
+			if err != nil {
+				return err
+			}
+		}
+		d.Revision = revision
+
+		_, err = tx.Exec(`
+			insert into decks (title, text, revision, creator, lastmod, created, modified)
+			values (?, ?, ?, ?, ?, ?, ?)
+			on conflict(title)
+			do update set
+				text = excluded.text,
+				revision = excluded.revision,
+				creator = excluded.creator,
+				lastmod = excluded.lastmod,
+				created = excluded.created,
+				modified = excluded.modified;
+		`,
+			d.Title, d.Text, d.Revision,
+			d.Creator.ID, d.LastMod.ID,
+			d.Created, d.Modified,
+		)
+		if err != nil {
+			return err
+		}
+		return saveDeckSongs(tx, d.Title, d.Text)
+	})
+	if err == ErrConflict {
+		log.Debug().Str("title", d.Title).Int("expected", expected).Msg("not saved: conflict")
+		return err
+	} else if err != nil {
 		log.Debug().Str("title", d.Title).Err(err).Msg("could not save")
 		return errCouldNotSave
 	}
-	log.Debug().Str("title", d.Title).Msg("saved")
+	log.Debug().Str("title", d.Title).Int("revision", d.Revision).Msg("saved")
 	return nil
 }
 
 func (d Deck) Delete() error {
 	var count int64
-	resp, err := execQuery(`delete from decks where title = ?`, d.Title)
-	if err == nil {
-		count, err = resp.RowsAffected()
-	}
+	err := withTx(func(tx *sql.Tx) error {
+		resp, err := tx.Exec(`delete from decks where title = ?`, d.Title)
+		if err == nil {
+			count, err = resp.RowsAffected()
+		}
+		if err == nil {
+			_, err = tx.Exec(`delete from deck_songs where title = ?`, d.Title)
+		}
+		return err
+	})
 	if err != nil {
 		log.Debug().Str("title", d.Title).Err(err).Msg("could not delete")
 		return errCouldNotSave
@@ -94,6 +166,35 @@ func (d Deck) Delete() error {
 	return nil
 }
 
+// SaveCurrent stores what's being shown on the deck's screens.
+// Titles without a deck are ignored.
+func SaveCurrent(title, current string) error {
+	if _, err := execQuery(`update decks set current = ? where title = ?`, current, title); err != nil {
+		log.Debug().Str("title", title).Err(err).Msg("could not save current")
+		return errCouldNotSave
+	}
+	return nil
+}
+
+// LoadCurrent returns what's being shown on the screens of each deck
+func LoadCurrent() map[string]string {
+	rows, err := runQuery(`select title, current from decks where current is not null`)
+	if err != nil {
+		log.Fatal().Msg("could not load current")
+	}
+	defer rows.Close()
+
+	current := map[string]string{}
+	for rows.Next() {
+		var title, content string
+		if err := rows.Scan(&title, &content); err != nil {
+			log.Fatal().Err(err).Msg("could not scan current")
+		}
+		current[title] = content
+	}
+	return current
+}
+
 func ResolveAliases(title string) string {
 	const days = time.Hour * 24
 	const fmt = "2006-01-02"
@@ -137,7 +238,7 @@ func ResolveAliases(title string) string {
 func LoadDeck(title string) (Deck, bool) {
 	rows, err := runQuery(`
 		select
-			D.title, D.text,
+			D.title, D.text, D.revision,
 			D.created, D.modified,
 			coalesce(UC.username, "system"), coalesce(UC.name, "System"),
 			coalesce(UM.username, "system"), coalesce(UM.name, "System")
@@ -157,7 +258,7 @@ func LoadDeck(title string) (Deck, bool) {
 		return d, false
 	}
 	err = rows.Scan(
-		&d.Title, &d.Text,
+		&d.Title, &d.Text, &d.Revision,
 		&d.Created, &d.Modified,
 		&d.Creator.ID, &d.Creator.Name,
 		&d.LastMod.ID, &d.LastMod.Name,
@@ -194,7 +295,7 @@ func (ds DeckTitles) Swap(i, j int)      { ds[i], ds[j] = ds[j], ds[i] }
 func LoadDecks() Decks {
 	rows, err := runQuery(`
 		select
-			D.title, D.text,
+			D.title, D.text, D.revision,
 			D.created, D.modified,
 			coalesce(UC.username, "system"), coalesce(UC.name, "System"),
 			coalesce(UM.username, "system"), coalesce(UM.name, "System")
@@ -210,7 +311,7 @@ func LoadDecks() Decks {
 	for rows.Next() {
 		var d Deck
 		err = rows.Scan(
-			&d.Title, &d.Text,
+			&d.Title, &d.Text, &d.Revision,
 			&d.Created, &d.Modified,
 			&d.Creator.ID, &d.Creator.Name,
 			&d.LastMod.ID, &d.LastMod.Name,
@@ -224,39 +325,42 @@ func LoadDecks() Decks {
 	return decks
 }
 
-var reLabelSongId = regexp.MustCompile(`^\s*#.*\(@([0-9]+)\)`)
-
-// ListDecks returns a sorted list of decks
+// ListDecks returns a sorted list of decks, with the songs each one uses
 func ListDecks(text string) DeckTitles {
 	var args []any
-	query := `select title, text from decks`
+	decks := `decks`
 	if text = inout.FilterLetters(text); text != "" {
-		query += ` where text like $1 limit 25`
+		decks = `(select title from decks where text like $1 limit 25)`
 		args = append(args, text)
 	}
+	query := `
+		select D.title, DS.song_id
+		from ` + decks + ` D
+		left join deck_songs DS on (DS.title = D.title)
+		order by D.title, DS.position`
 
 	var ls DeckTitles
 	rows, err := runQuery(query, args...)
 	if err != nil {
 		log.Err(err).Msg("querying decks")
+		return ls
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var title, text *string
-		if err := rows.Scan(&title, &text); err == nil && title != nil {
-			item := DeckItem{Title: *title}
-			if text != nil {
-				for _, line := range strings.Split(*text, "\n") {
-					if m := reLabelSongId.FindStringSubmatch(line); len(m) > 1 {
-						if id, err := strconv.Atoi(m[1]); err == nil {
-							item.Songs = append(item.Songs, id)
-						}
-					}
-				}
-			}
-
-			ls = append(ls, item)
+		var (
+			title  string
+			songID *int
+		)
+		if err := rows.Scan(&title, &songID); err != nil {
+			log.Err(err).Msg("scanning decks")
+			break
+		}
+		if len(ls) == 0 || ls[len(ls)-1].Title != title {
+			ls = append(ls, DeckItem{Title: title})
+		}
+		if songID != nil {
+			ls[len(ls)-1].Songs = append(ls[len(ls)-1].Songs, *songID)
 		}
 	}
 
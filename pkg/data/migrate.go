@@ -0,0 +1,167 @@
+package data
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	//go:embed migrations/*.sql
+	migrationFiles embed.FS
+
+	// migrations which can't be done with plain SQL
+	goMigrations = []Migration{
+		{Version: 3, Name: "song_users", up: func(tx *sql.Tx) error {
+			if err := addColumn(tx, "songs", "creator", "text"); err != nil {
+				return err
+			}
+			return addColumn(tx, "songs", "lastmod", "text")
+		}},
+		{Version: 8, Name: "deck_songs", up: createDeckSongs},
+		{Version: 12, Name: "deck_songs_refs", up: fillDeckSongs},
+	}
+
+	migrations = loadMigrations()
+)
+
+// Migration changes the schema from the previous version
+type Migration struct {
+	Version int        `json:"version"`
+	Name    string     `json:"name"`
+	Applied *time.Time `json:"applied,omitempty"`
+	up      func(tx *sql.Tx) error
+}
+
+// loadMigrations returns all migrations, sorted by version. SQL migrations
+// are named like "0001_name.sql".
+func loadMigrations() []Migration {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		panic(err)
+	}
+
+	list := append([]Migration{}, goMigrations...)
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".sql")
+		prefix, name, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			panic(fmt.Sprintf("bad migration name %q", e.Name()))
+		}
+
+		buf, err := migrationFiles.ReadFile(path.Join("migrations", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		query := string(buf)
+		list = append(list, Migration{Version: version, Name: name, up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(query)
+			return err
+		}})
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	for i := 1; i < len(list); i++ {
+		if list[i].Version == list[i-1].Version {
+			panic(fmt.Sprintf("duplicate migration version %d", list[i].Version))
+		}
+	}
+	return list
+}
+
+// addColumn adds a column to the table, if it's not there yet
+func addColumn(tx *sql.Tx, table, column, definition string) error {
+	var count int
+	err := tx.QueryRow(`select count(*) from pragma_table_info(?) where name = ?`, table, column).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	_, err = tx.Exec(fmt.Sprintf(`alter table %s add column %s %s`, table, column, definition))
+	return err
+}
+
+// MigrationStatus returns all known migrations, and when they were applied
+func MigrationStatus() ([]Migration, error) {
+	if _, err := execQuery(`
+		create table if not exists schema_version (
+			version integer primary key,
+			name text,
+			applied datetime default current_timestamp
+		);
+	`); err != nil {
+		return nil, err
+	}
+
+	rows, err := runQuery(`select version, applied from schema_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var (
+			version int
+			when    time.Time
+		)
+		if err := rows.Scan(&version, &when); err != nil {
+			return nil, err
+		}
+		applied[version] = when
+	}
+
+	list := make([]Migration, len(migrations))
+	for i, m := range migrations {
+		list[i] = m
+		if when, found := applied[m.Version]; found {
+			list[i].Applied = &when
+		}
+	}
+	return list, nil
+}
+
+// Migrate applies the pending migrations, each on its own transaction.
+// It returns the number of applied migrations.
+func Migrate() (int, error) {
+	list, err := MigrationStatus()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range list {
+		if m.Applied != nil {
+			continue
+		}
+
+		mlog := log.With().Int("version", m.Version).Str("name", m.Name).Logger()
+		tx, err := db.Begin()
+		if err != nil {
+			return count, err
+		}
+		if err = m.up(tx); err == nil {
+			_, err = tx.Exec(`insert into schema_version (version, name) values (?, ?)`, m.Version, m.Name)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			mlog.Err(err).Msg("migration failed")
+			return count, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		if err = tx.Commit(); err != nil {
+			return count, err
+		}
+
+		mlog.Info().Msg("migrated")
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/paupin2/slides/pkg/config"
+)
+
+// openTestDB opens an empty database, without migrating it
+func openTestDB(t *testing.T) {
+	t.Helper()
+	config.Config.Path.Db = filepath.Join(t.TempDir(), "test.sqlite3")
+	db = nil
+	Open()
+	t.Cleanup(func() {
+		db.Close()
+		db = nil
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	openTestDB(t)
+
+	// a database created before migrations existed
+	_, err := db.Exec(`
+		create table songs (
+			rowid integer primary key,
+			external_id text unique,
+			title text not null,
+			author text,
+			ccli text,
+			content text,
+			created datetime default current_timestamp,
+			modified datetime default current_timestamp
+		);
+		insert into songs (title, content) values ('Song', 'la la la');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := Migrate()
+	if err != nil {
+		t.Fatal(err)
+	} else if count != len(migrations) {
+		t.Errorf("expected %d migrations, but applied %d", len(migrations), count)
+	}
+
+	if song := SongByID(1); song == nil || song.Title != "Song" || song.Creator.ID != SystemUserID {
+		t.Errorf("bad song after migration: %+v", song)
+	}
+
+	// nothing else to apply
+	if count, err = Migrate(); err != nil || count != 0 {
+		t.Errorf("expected no migrations, but got %d/%v", count, err)
+	}
+
+	list, err := MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range list {
+		if m.Applied == nil {
+			t.Errorf("migration %d (%s) was not applied", m.Version, m.Name)
+		}
+	}
+}
+
+func TestMigrateRollback(t *testing.T) {
+	openTestDB(t)
+
+	defer func(saved []Migration) { migrations = saved }(migrations)
+	migrations = []Migration{
+		{Version: 1, Name: "ok", up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`create table a (x text)`)
+			return err
+		}},
+		{Version: 2, Name: "broken", up: func(tx *sql.Tx) error {
+			if _, err := tx.Exec(`create table b (x text)`); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`not sql`)
+			return err
+		}},
+	}
+
+	if count, err := Migrate(); err == nil || count != 1 {
+		t.Fatalf("expected an error after 1 migration, but got %d/%v", count, err)
+	}
+
+	var tables int
+	if err := db.QueryRow(`select count(*) from sqlite_master where name in ('a', 'b')`).Scan(&tables); err != nil {
+		t.Fatal(err)
+	} else if tables != 1 {
+		t.Errorf("expected only the first migration's table, but found %d tables", tables)
+	}
+}
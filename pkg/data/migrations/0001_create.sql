@@ -1,3 +1,4 @@
+-- the tables existed before migrations, so they're only created if needed
 create table if not exists users (
 	rowid integer primary key,
 	username text not null unique,
@@ -0,0 +1,6 @@
+create table if not exists sessions (
+	token text primary key,
+	username text not null,
+	created datetime default current_timestamp,
+	expires datetime not null
+);
@@ -0,0 +1,18 @@
+create table deck_revisions (
+	rowid integer primary key,
+	title text not null,
+	revision integer not null,
+	text text,
+	author text,
+	created datetime default current_timestamp,
+	unique (title, revision)
+);
+
+alter table decks add column revision integer not null default 0;
+
+-- the existing decks become their first revision
+insert into deck_revisions (title, revision, text, author, created)
+select title, 1, text, coalesce(lastmod, 'system'), modified
+from decks;
+
+update decks set revision = 1;
@@ -0,0 +1,6 @@
+-- where each external source was last synced up to
+create table sync_state (
+	source text primary key,
+	cursor datetime not null,
+	synced datetime default current_timestamp
+);
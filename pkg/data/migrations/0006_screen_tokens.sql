@@ -0,0 +1,13 @@
+-- links to a deck's screens, for people who can't log in
+create table screen_tokens (
+	id integer primary key,
+	token text not null unique, -- sha256 of the token given out
+	title text not null,
+	label text,
+	creator text references users(username),
+	created datetime default current_timestamp,
+	expires datetime not null,
+	revoked datetime
+);
+
+create index screen_tokens_title on screen_tokens(title);
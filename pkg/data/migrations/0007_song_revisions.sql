@@ -0,0 +1,2 @@
+-- songs are saved only if they weren't changed since they were loaded
+alter table songs add column revision integer not null default 1;
@@ -0,0 +1,8 @@
+-- more about each song, mostly from planning center
+alter table songs add column copyright text;
+alter table songs add column themes text;
+alter table songs add column admin text;
+alter table songs add column notes text;
+alter table songs add column last_scheduled_at datetime;
+alter table songs add column musical_key text;
+alter table songs add column tempo integer;
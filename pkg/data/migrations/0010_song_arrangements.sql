@@ -0,0 +1,15 @@
+-- versions of a song, like a short one, or one with a key change
+create table song_arrangements (
+	id integer primary key,
+	song_id integer not null,
+	external_id text, -- set if imported
+	name text not null,
+	musical_key text,
+	tempo integer,
+	sequence text, -- comma-separated section names, in order
+	content text not null,
+	modified datetime default current_timestamp
+);
+
+create index song_arrangements_song on song_arrangements(song_id);
+create unique index song_arrangements_external on song_arrangements(song_id, external_id);
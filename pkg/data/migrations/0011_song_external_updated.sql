@@ -0,0 +1,2 @@
+-- when each imported song was last changed on planning center, as imported
+alter table songs add column external_updated datetime;
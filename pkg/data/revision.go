@@ -0,0 +1,74 @@
+package data
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DeckRevision is the text of a deck, as saved at some point
+type DeckRevision struct {
+	Title    string    `json:"title"`
+	Revision int       `json:"revision"`
+	Text     string    `json:"text,omitempty"`
+	Author   User      `json:"author"`
+	Created  time.Time `json:"created"`
+}
+
+func queryRevisions(withText bool, whereetc string, args ...interface{}) []DeckRevision {
+	text := `''`
+	if withText {
+		text = `R.text`
+	}
+	query := `
+		select
+			R.title, R.revision, coalesce(` + text + `, ''),
+			coalesce(U.username, "system"), coalesce(U.name, "System"),
+			R.created
+		from deck_revisions R
+		left join users U on (U.username = R.author)
+	` + whereetc
+
+	rows, err := runQuery(query, args...)
+	if err != nil {
+		log.Err(err).Str("sql", query).Msg("querying revisions")
+		return nil
+	}
+	defer rows.Close()
+
+	var list []DeckRevision
+	for rows.Next() {
+		var r DeckRevision
+		err := rows.Scan(
+			&r.Title, &r.Revision, &r.Text,
+			&r.Author.ID, &r.Author.Name,
+			&r.Created,
+		)
+		if err != nil {
+			log.Err(err).Msg("scanning revision")
+			return nil
+		}
+		list = append(list, r)
+	}
+	return list
+}
+
+// DeckRevisions returns the deck's revisions, without their text, newest first
+func DeckRevisions(title string) []DeckRevision {
+	return queryRevisions(false, `
+		where R.title = ?
+		order by R.revision desc
+	`, ResolveAliases(title))
+}
+
+// LoadDeckRevision loads a revision of the deck
+func LoadDeckRevision(title string, revision int) (DeckRevision, bool) {
+	list := queryRevisions(true, `
+		where R.title = ? and R.revision = ?
+		limit 1
+	`, ResolveAliases(title), revision)
+	if len(list) == 0 {
+		return DeckRevision{}, false
+	}
+	return list[0], true
+}
@@ -0,0 +1,96 @@
+package data
+
+import "testing"
+
+func TestDeckRevisions(t *testing.T) {
+	openTestDB(t)
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	deck := Deck{Title: "2022-05-01", Text: "one"}
+	for _, text := range []string{"one", "two", "two"} {
+		deck.Text = text
+		if err := deck.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if deck.Revision != 2 {
+		t.Errorf("expected revision 2, but got %d", deck.Revision)
+	}
+
+	list := DeckRevisions(deck.Title)
+	if len(list) != 2 || list[0].Revision != 2 || list[1].Revision != 1 {
+		t.Fatalf("bad revisions: %+v", list)
+	}
+
+	// revision numbers continue after deleting the deck
+	if err := deck.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	deck = Deck{Title: deck.Title, Text: "three"}
+	if err := deck.Save(); err != nil {
+		t.Fatal(err)
+	} else if deck.Revision != 3 {
+		t.Errorf("expected revision 3, but got %d", deck.Revision)
+	}
+
+	if rev, found := LoadDeckRevision(deck.Title, 1); !found || rev.Text != "one" {
+		t.Errorf("bad first revision: %+v", rev)
+	}
+}
+
+func TestSaveIf(t *testing.T) {
+	openTestDB(t)
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// two editors load the same deck, and both save it
+	deck := Deck{Title: "2022-05-08", Text: "one"}
+	if err := deck.SaveIf(0); err != nil {
+		t.Fatal(err)
+	}
+	stale := deck
+	deck.Text = "two"
+	if err := deck.SaveIf(1); err != nil {
+		t.Fatal(err)
+	}
+	stale.Text = "three"
+	if err := stale.SaveIf(1); err != ErrConflict {
+		t.Errorf("expected a conflict, but got %v", err)
+	}
+	if saved, _ := LoadDeck(deck.Title); saved.Text != "two" || saved.Revision != 2 {
+		t.Errorf("bad saved deck: %+v", saved)
+	}
+	if err := (&Deck{Title: deck.Title, Text: "new"}).SaveIf(0); err != ErrConflict {
+		t.Errorf("expected a conflict creating an existing deck, but got %v", err)
+	}
+	if err := deck.SaveIf(-1); err != ErrConflict {
+		t.Errorf("expected a conflict saving at revision -1, but got %v", err)
+	}
+
+	// songs too
+	song := Song{Title: "Grace", Content: "Amazing grace"}
+	if !song.Save() || song.Revision != 1 {
+		t.Fatalf("bad new song: %+v", song)
+	}
+	song.Content = "How sweet"
+	if err := song.SaveIf(1); err != nil || song.Revision != 2 {
+		t.Fatalf("bad update: %v, %+v", err, song)
+	}
+	if err := song.SaveIf(1); err != ErrConflict {
+		t.Errorf("expected a conflict, but got %v", err)
+	}
+	for _, revision := range []int{0, -1} {
+		if err := song.SaveIf(revision); err != ErrConflict {
+			t.Errorf("expected a conflict saving at revision %d, but got %v", revision, err)
+		}
+	}
+	if saved := SongByID(song.RowID); saved.Revision != 2 || saved.Content != "How sweet" {
+		t.Errorf("bad saved song: %+v", saved)
+	}
+	if err := (&Song{RowID: 999, Title: "x", Content: "y"}).SaveIf(1); err != ErrNotFound {
+		t.Errorf("expected not found, but got %v", err)
+	}
+}
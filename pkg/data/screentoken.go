@@ -0,0 +1,134 @@
+package data
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// MaxScreenTokenDuration is the longest a screen token can be valid for
+const MaxScreenTokenDuration = 90 * 24 * time.Hour
+
+var (
+	errBadDuration = errors.New("bad duration")
+	ErrNotFound    = errors.New("not found")
+)
+
+// ScreenToken gives access to a deck's screens, without logging in. The
+// token itself is only known when it's created.
+type ScreenToken struct {
+	ID      int        `json:"id"`
+	Title   string     `json:"title"`
+	Label   string     `json:"label"`
+	Creator User       `json:"creator"`
+	Created time.Time  `json:"created"`
+	Expires time.Time  `json:"expires"`
+	Revoked *time.Time `json:"revoked,omitempty"`
+}
+
+// Valid returns true if the token wasn't revoked, and hasn't expired
+func (st ScreenToken) Valid() bool {
+	return st.Revoked == nil && st.Expires.After(time.Now())
+}
+
+// NewScreenToken creates a token for the deck's screens, valid for the
+// duration, returning the token to give out
+func NewScreenToken(title, label string, creator User, d time.Duration) (string, ScreenToken, error) {
+	st := ScreenToken{Title: title, Label: label, Creator: creator}
+	if err := CheckTitle(title); err != nil {
+		return "", st, err
+	} else if d <= 0 || d > MaxScreenTokenDuration {
+		return "", st, errBadDuration
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return "", st, err
+	}
+
+	st.Created = time.Now().UTC()
+	st.Expires = st.Created.Add(d)
+	res, err := execQuery(`
+		insert into screen_tokens (token, title, label, creator, created, expires)
+		values (?, ?, ?, ?, ?, ?);
+	`, hashToken(token), title, label, creator.ID, st.Created, st.Expires)
+	if err != nil {
+		return "", st, errCouldNotSave
+	}
+	id, _ := res.LastInsertId()
+	st.ID = int(id)
+	log.Info().Str("title", title).Int("id", st.ID).Time("expires", st.Expires).Msg("created screen token")
+	return token, st, nil
+}
+
+func queryScreenTokens(whereetc string, args ...interface{}) []ScreenToken {
+	query := `
+		select
+			T.id, T.title, coalesce(T.label, ''),
+			coalesce(U.username, "system"), coalesce(U.name, "System"),
+			T.created, T.expires, T.revoked
+		from screen_tokens T
+		left join users U on (U.username = T.creator)
+	` + whereetc
+
+	rows, err := runQuery(query, args...)
+	if err != nil {
+		log.Err(err).Str("sql", query).Msg("querying screen tokens")
+		return nil
+	}
+	defer rows.Close()
+
+	var list []ScreenToken
+	for rows.Next() {
+		var st ScreenToken
+		err := rows.Scan(
+			&st.ID, &st.Title, &st.Label,
+			&st.Creator.ID, &st.Creator.Name,
+			&st.Created, &st.Expires, &st.Revoked,
+		)
+		if err != nil {
+			log.Err(err).Msg("scanning screen token")
+			return nil
+		}
+		list = append(list, st)
+	}
+	return list
+}
+
+// ScreenTokens returns the deck's tokens (or all, if the title is empty)
+// that didn't expire yet, newest first
+func ScreenTokens(title string) []ScreenToken {
+	return queryScreenTokens(`
+		where (? = '' or T.title = ?) and T.expires > ?
+		order by T.id desc
+	`, title, title, time.Now().UTC())
+}
+
+// ScreenTokenFor returns the token, if it gives access to the deck
+func ScreenTokenFor(token, title string) (ScreenToken, bool) {
+	if token == "" {
+		return ScreenToken{}, false
+	}
+	list := queryScreenTokens(`where T.token = ? and T.title = ?`, hashToken(token), title)
+	if len(list) != 1 || !list[0].Valid() {
+		return ScreenToken{}, false
+	}
+	return list[0], true
+}
+
+// RevokeScreenToken stops the token from being used
+func RevokeScreenToken(id int) error {
+	res, err := execQuery(`
+		update screen_tokens set revoked = ?
+		where id = ? and revoked is null
+	`, time.Now().UTC(), id)
+	if err != nil {
+		return errCouldNotSave
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	log.Info().Int("id", id).Msg("revoked screen token")
+	return nil
+}
@@ -0,0 +1,45 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScreenTokens(t *testing.T) {
+	openTestDB(t)
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	token, st, err := NewScreenToken("2022-06-05", "zoom", SystemUser(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := NewScreenToken("2022-06-05", "", SystemUser(), MaxScreenTokenDuration+time.Hour); err == nil {
+		t.Error("expected an error for a long duration")
+	}
+
+	if found, ok := ScreenTokenFor(token, "2022-06-05"); !ok || found.ID != st.ID {
+		t.Error("expected the token to be valid")
+	}
+	for _, bad := range [][2]string{{token, "2022-06-12"}, {"", "2022-06-05"}, {"x", "2022-06-05"}} {
+		if _, ok := ScreenTokenFor(bad[0], bad[1]); ok {
+			t.Errorf("expected the token to be valid only for its deck, got %v", bad)
+		}
+	}
+	if list := ScreenTokens("2022-06-05"); len(list) != 1 || list[0].Label != "zoom" || list[0].ID != st.ID {
+		t.Errorf("bad list: %+v", list)
+	}
+
+	if err := RevokeScreenToken(st.ID); err != nil {
+		t.Fatal(err)
+	} else if err := RevokeScreenToken(st.ID); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, but got %v", err)
+	}
+	if _, ok := ScreenTokenFor(token, "2022-06-05"); ok {
+		t.Error("expected the revoked token to be invalid")
+	}
+	if list := ScreenTokens(""); len(list) != 1 || list[0].Revoked == nil {
+		t.Errorf("bad list after revoking: %+v", list)
+	}
+}
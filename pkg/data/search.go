@@ -0,0 +1,229 @@
+package data
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// HighlightStart and HighlightEnd surround the matched words on
+	// SongMatch's Title and Snippet
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+// SongMatch is a song found by SearchSongs
+type SongMatch struct {
+	Song    *Song
+	Title   string // title, with the matched words highlighted
+	Snippet string // part of the lyrics, with the matched words highlighted
+}
+
+var searchIndex = false
+
+// ensureSearchIndex creates the full-text index for songs, if sqlite was
+// built with FTS5 (see the Makefile). The index only holds data derived from
+// the songs table, so it's created here instead of on a migration, so that
+// it's also built when an existing database starts being used with FTS5.
+func ensureSearchIndex() {
+	var available, exists, triggers int
+	_ = db.QueryRow(`select sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&available)
+	_ = db.QueryRow(`select count(*) from sqlite_master where name = 'songs_fts'`).Scan(&exists)
+	_ = db.QueryRow(`select count(*) from sqlite_master where type = 'trigger' and name like 'songs_fts_%'`).Scan(&triggers)
+
+	if available == 0 {
+		// without FTS5, the triggers would make saving songs fail
+		log.Warn().Msg("sqlite built without FTS5, song search won't use the index")
+		if _, err := execQuery(`
+			drop trigger if exists songs_fts_insert;
+			drop trigger if exists songs_fts_delete;
+			drop trigger if exists songs_fts_update;
+		`); err != nil {
+			log.Fatal().Err(err).Msg("could not drop search triggers")
+		}
+		return
+	}
+
+	if exists == 0 {
+		_, err := execQuery(`
+			create virtual table songs_fts using fts5(
+				title, author, ccli, content,
+				content = 'songs',
+				content_rowid = 'rowid',
+				tokenize = 'unicode61 remove_diacritics 2'
+			);
+		`)
+		if err != nil {
+			log.Fatal().Err(err).Msg("could not create search index")
+		}
+		log.Info().Msg("created search index")
+	}
+
+	// keep the index in sync with the songs
+	_, err := execQuery(`
+		create trigger if not exists songs_fts_insert after insert on songs begin
+			insert into songs_fts (rowid, title, author, ccli, content)
+			values (new.rowid, new.title, new.author, new.ccli, new.content);
+		end;
+		create trigger if not exists songs_fts_delete after delete on songs begin
+			insert into songs_fts (songs_fts, rowid, title, author, ccli, content)
+			values ('delete', old.rowid, old.title, old.author, old.ccli, old.content);
+		end;
+		create trigger if not exists songs_fts_update after update on songs begin
+			insert into songs_fts (songs_fts, rowid, title, author, ccli, content)
+			values ('delete', old.rowid, old.title, old.author, old.ccli, old.content);
+			insert into songs_fts (rowid, title, author, ccli, content)
+			values (new.rowid, new.title, new.author, new.ccli, new.content);
+		end;
+	`)
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not create search triggers")
+	}
+
+	// without the triggers (as when it was used without FTS5), songs may
+	// have changed without the index
+	if exists == 0 || triggers < 3 {
+		if _, err := execQuery(`insert into songs_fts(songs_fts) values ('rebuild');`); err != nil {
+			log.Fatal().Err(err).Msg("could not rebuild search index")
+		}
+		log.Info().Msg("rebuilt search index")
+	}
+	searchIndex = true
+}
+
+// searchWords splits the text into words, ignoring punctuation
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// SongFilter narrows songs down by their details. Empty fields match every
+// song.
+type SongFilter struct {
+	Theme     string // text on one of the themes
+	Key       string // the musical key, ignoring case
+	Copyright string // text on the copyright, or on who administers it
+	MinTempo  int
+	MaxTempo  int
+}
+
+// where returns the filter's conditions on songs "S", each one starting
+// with "and", and their arguments
+func (f SongFilter) where() (string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if f.Theme != "" {
+		conds = append(conds, `and S.themes like ?`)
+		args = append(args, "%"+f.Theme+"%")
+	}
+	if f.Key != "" {
+		conds = append(conds, `and S.musical_key = ? collate nocase`)
+		args = append(args, f.Key)
+	}
+	if f.Copyright != "" {
+		conds = append(conds, `and (coalesce(S.copyright, '') || ' ' || coalesce(S.admin, '')) like ?`)
+		args = append(args, "%"+f.Copyright+"%")
+	}
+	if f.MinTempo > 0 {
+		conds = append(conds, `and S.tempo >= ?`)
+		args = append(args, f.MinTempo)
+	}
+	if f.MaxTempo > 0 {
+		conds = append(conds, `and S.tempo <= ?`)
+		args = append(args, f.MaxTempo)
+	}
+	return strings.Join(conds, " "), args
+}
+
+// FilterSongs returns the songs matching the filter, by title
+func FilterSongs(f SongFilter) []*Song {
+	conds, args := f.where()
+	return querySongs(0, `where 1 `+conds+` order by title`, args...)
+}
+
+// SearchSongs returns the songs with all words of the text on their title,
+// author, CCLI number or lyrics, and matching the filter, best matches
+// first. The last word is matched as a prefix, so that searching works
+// while typing.
+func SearchSongs(text string, f SongFilter, limit int) []SongMatch {
+	words := searchWords(text)
+	if len(words) == 0 {
+		return nil
+	} else if !searchIndex {
+		return searchSongsLike(words, f, limit)
+	}
+
+	terms := make([]string, len(words))
+	for i, w := range words {
+		terms[i] = `"` + w + `"`
+	}
+	terms[len(terms)-1] += "*"
+
+	var matches []SongMatch
+	conds, condArgs := f.where()
+	query := songColumns + `,
+		highlight(songs_fts, 0, ?, ?),
+		snippet(songs_fts, 3, ?, ?, '…', 12)
+	from songs_fts
+	join songs S on (S.rowid = songs_fts.rowid)
+	where songs_fts match ? ` + conds + `
+	order by bm25(songs_fts, 10.0, 5.0, 5.0, 1.0)
+	limit ?
+	`
+	args := []interface{}{
+		HighlightStart, HighlightEnd,
+		HighlightStart, HighlightEnd,
+		strings.Join(terms, " "),
+	}
+	args = append(append(args, condArgs...), limit)
+	rows, err := runQuery(query, args...)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m SongMatch
+		var title, snippet *string
+		song, err := scanSong(rows, &title, &snippet)
+		if err != nil {
+			log.Err(err).Msg("scanning song match")
+			return nil
+		}
+
+		m.Song = &song
+		if title != nil {
+			m.Title = *title
+		}
+		if snippet != nil && strings.Contains(*snippet, HighlightStart) {
+			m.Snippet = *snippet
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// searchSongsLike is used when there's no full-text index
+func searchSongsLike(words []string, f SongFilter, limit int) []SongMatch {
+	var (
+		where []string
+		args  []interface{}
+	)
+	for _, w := range words {
+		where = append(where, `(title || ' ' || coalesce(author, '') || ' ' || coalesce(ccli, '') || ' ' || coalesce(content, '')) like ?`)
+		args = append(args, "%"+w+"%")
+	}
+	conds, condArgs := f.where()
+	args = append(append(args, condArgs...), limit)
+
+	var matches []SongMatch
+	for _, song := range querySongs(limit, `where `+strings.Join(where, " and ")+` `+conds+` order by title limit ?`, args...) {
+		matches = append(matches, SongMatch{Song: song, Title: song.Title})
+	}
+	return matches
+}
@@ -0,0 +1,120 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSearchSongs(t *testing.T) {
+	openTestDB(t)
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ensureSearchIndex()
+
+	for _, s := range []Song{
+		{Title: "Amazing Grace", Author: "John Newton", Content: "Amazing grace, how sweet the sound\nThat saved a wretch like me"},
+		{Title: "How Great Thou Art", CCLI: "14181", Content: "O Lord my God, when I in awesome wonder"},
+		{Title: "Grace Alone", Content: "Every promise we can make"},
+	} {
+		if !s.Save() {
+			t.Fatalf("could not save %s", s.Title)
+		}
+	}
+
+	check := func(text string, expected ...string) {
+		t.Helper()
+		found := SearchSongs(text, SongFilter{}, 10)
+		if len(found) != len(expected) {
+			t.Errorf("searching %q expected %d songs, but got %d", text, len(expected), len(found))
+			return
+		}
+		for i, m := range found {
+			if m.Song.Title != expected[i] {
+				t.Errorf("searching %q expected %q at %d, but got %q", text, expected[i], i, m.Song.Title)
+			}
+		}
+	}
+
+	check("amazing grace", "Amazing Grace")
+	check("wretch like", "Amazing Grace")
+	check("newton", "Amazing Grace")
+	check("14181", "How Great Thou Art")
+	check("awesome wond", "How Great Thou Art")
+	check("nothing like this")
+	check("!!")
+
+	// saved songs are kept in the index
+	song := SongByID(3)
+	song.Content = "Nothing but the blood"
+	if !song.Save() {
+		t.Fatal("could not update")
+	}
+	check("promise")
+	check("blood", "Grace Alone")
+
+	if err := song.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	check("blood")
+
+	// songs saved while the index wasn't kept, as without FTS5, are found
+	// once it is again
+	if _, err := db.Exec(`drop trigger if exists songs_fts_insert`); err != nil {
+		t.Fatal(err)
+	}
+	if s := (Song{Title: "Cornerstone", Content: "My hope is built on nothing less"}); !s.Save() {
+		t.Fatal("could not save")
+	}
+	ensureSearchIndex()
+	check("cornerstone", "Cornerstone")
+}
+
+func TestFilterSongs(t *testing.T) {
+	openTestDB(t)
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	ensureSearchIndex()
+
+	scheduled := time.Date(2019, 9, 1, 15, 0, 0, 0, time.UTC)
+	for _, s := range []Song{
+		{Title: "10,000 Reasons", Content: "Bless the Lord", Themes: "Adoration, Blessing", Key: "G", Tempo: 73,
+			Copyright: "2011 Thankyou Music", Admin: "Capitol CMG Publishing", LastScheduledAt: scheduled},
+		{Title: "Holy Holy Holy", Content: "Lord God Almighty", Themes: "Adoration, Trinity", Key: "D", Tempo: 100},
+		{Title: "Blessed Be Your Name", Content: "Blessed be your name", Key: "b", Tempo: 120},
+	} {
+		if !s.Save() {
+			t.Fatalf("could not save %s", s.Title)
+		}
+	}
+
+	if song := SongByID(1); song.Themes != "Adoration, Blessing" || song.Key != "G" || song.Tempo != 73 ||
+		song.Admin != "Capitol CMG Publishing" || !song.LastScheduledAt.Equal(scheduled) {
+		t.Errorf("bad song details: %+v", song)
+	}
+
+	check := func(f SongFilter, expected ...string) {
+		t.Helper()
+		found := FilterSongs(f)
+		if len(found) != len(expected) {
+			t.Errorf("filtering %+v expected %d songs, but got %d", f, len(expected), len(found))
+			return
+		}
+		for i, s := range found {
+			if s.Title != expected[i] {
+				t.Errorf("filtering %+v expected %q at %d, but got %q", f, expected[i], i, s.Title)
+			}
+		}
+	}
+	check(SongFilter{}, "10,000 Reasons", "Blessed Be Your Name", "Holy Holy Holy")
+	check(SongFilter{Theme: "adoration"}, "10,000 Reasons", "Holy Holy Holy")
+	check(SongFilter{Key: "B"}, "Blessed Be Your Name")
+	check(SongFilter{Copyright: "capitol"}, "10,000 Reasons")
+	check(SongFilter{MinTempo: 80}, "Blessed Be Your Name", "Holy Holy Holy")
+	check(SongFilter{MinTempo: 80, MaxTempo: 110, Theme: "trinity"}, "Holy Holy Holy")
+
+	if found := SearchSongs("lord", SongFilter{Key: "d"}, 10); len(found) != 1 || found[0].Song.Title != "Holy Holy Holy" {
+		t.Errorf("bad filtered search: %+v", found)
+	}
+}
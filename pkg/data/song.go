@@ -7,7 +7,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/paupin2/slides/cmd/slides/pkg/inout"
 	"github.com/rs/zerolog/log"
 )
 
@@ -18,8 +17,20 @@ type Song struct {
 	Author     string
 	CCLI       string
 	Content    string
+	Revision   int // incremented on every update
+	Creator    User
+	LastMod    User
 	Created    time.Time
 	Modified   time.Time
+
+	Copyright       string
+	Themes          string // comma-separated
+	Admin           string // who administers the copyright
+	Notes           string
+	Key             string // musical key, like "G" or "Bbm"
+	Tempo           int    // in beats per minute
+	LastScheduledAt time.Time
+	ExternalUpdated time.Time // when the imported version was changed on its source
 }
 
 var (
@@ -47,25 +58,43 @@ func (s *Song) String() string {
 	return id
 }
 
+// Delete removes the song, and its arrangements
 func (s *Song) Delete() error {
-	var count int64
-	resp, err := execQuery(`delete from songs where rowid = ?`, s.RowID)
-	if err == nil {
-		count, err = resp.RowsAffected()
-	}
+	err := withTx(func(tx *sql.Tx) error {
+		resp, err := tx.Exec(`delete from songs where rowid = ?`, s.RowID)
+		if err != nil {
+			return err
+		}
+		if count, err := resp.RowsAffected(); err != nil {
+			return err
+		} else if count < 1 {
+			return ErrNotFound
+		}
+		_, err = tx.Exec(`delete from song_arrangements where song_id = ?`, s.RowID)
+		return err
+	})
 	if err != nil {
 		log.Debug().Int("id", s.RowID).Err(err).Msg("could not delete song")
 		return err
 	}
-	if count < 1 {
-		return errors.New("not found")
-	}
 
 	log.Info().Int("id", s.RowID).Msg("deleted song")
 	return nil
 }
 
-func scanSong(rows *sql.Rows) (Song, error) {
+// songColumns selects the columns read by scanSong, from songs "S"
+const songColumns = `
+	select
+		S.rowid, S.external_id, S.title, S.author, S.ccli, S.content,
+		coalesce(S.creator, "system"), coalesce((select name from users where username = S.creator), "System"),
+		coalesce(S.lastmod, "system"), coalesce((select name from users where username = S.lastmod), "System"),
+		S.created, S.modified, S.revision,
+		S.copyright, S.themes, S.admin, S.notes, S.musical_key, S.tempo, S.last_scheduled_at,
+		S.external_updated`
+
+// scanSong reads a song selected with songColumns, and any extra columns
+// after them
+func scanSong(rows *sql.Rows, extra ...interface{}) (Song, error) {
 	var (
 		s          Song
 		externalID *string
@@ -73,17 +102,31 @@ func scanSong(rows *sql.Rows) (Song, error) {
 		author     *string
 		ccli       *string
 		content    *string
+		copyright  *string
+		themes     *string
+		admin      *string
+		notes      *string
+		key        *string
+		tempo      *int
+		scheduled  sql.NullTime
+		external   sql.NullTime
 	)
-	err := rows.Scan(
+	dest := []interface{}{
 		&s.RowID,
 		&externalID,
 		&title,
 		&author,
 		&ccli,
 		&content,
+		&s.Creator.ID, &s.Creator.Name,
+		&s.LastMod.ID, &s.LastMod.Name,
 		&s.Created,
 		&s.Modified,
-	)
+		&s.Revision,
+		&copyright, &themes, &admin, &notes, &key, &tempo, &scheduled,
+		&external,
+	}
+	err := rows.Scan(append(dest, extra...)...)
 
 	set := func(src, dest *string) {
 		if src != nil {
@@ -95,13 +138,26 @@ func scanSong(rows *sql.Rows) (Song, error) {
 	set(author, &s.Author)
 	set(ccli, &s.CCLI)
 	set(content, &s.Content)
+	set(copyright, &s.Copyright)
+	set(themes, &s.Themes)
+	set(admin, &s.Admin)
+	set(notes, &s.Notes)
+	set(key, &s.Key)
+	if tempo != nil {
+		s.Tempo = *tempo
+	}
+	if scheduled.Valid {
+		s.LastScheduledAt = scheduled.Time
+	}
+	if external.Valid {
+		s.ExternalUpdated = external.Time
+	}
 	return s, err
 }
 
 func querySongs(limit int, whereetc string, args ...interface{}) []*Song {
-	query := `
-	select rowid, external_id, title, author, ccli, content, created, modified
-	from songs
+	query := songColumns + `
+	from songs S
 	` + whereetc
 
 	rows, err := runQuery(query, args...)
@@ -147,19 +203,6 @@ func AllSongs(offset, limit int) []*Song {
 	`, limit, offset)
 }
 
-func AllSongsContaining(text string, offset, limit int) []*Song {
-	if text = inout.FilterLetters(text); text == "" {
-		return AllSongs(offset, limit)
-	}
-
-	return querySongs(limit, `
-		where title like $1
-		order by title
-		limit $2
-		offset $3
-	`, "%"+text+"%", limit, offset)
-}
-
 func SongByExternalID(id string) *Song {
 	if id == "" {
 		return nil
@@ -177,8 +220,25 @@ func SongByID(id int) *Song {
 // Save inserts or updates the song, updating the RowID id the song was
 // inserted.
 func (s *Song) Save() bool {
+	return s.save(-1) == nil
+}
+
+// SaveIf updates the song only if it's still at the revision, and returns
+// ErrConflict otherwise, or ErrNotFound if it was deleted
+func (s *Song) SaveIf(revision int) error {
+	if s.RowID == 0 {
+		return ErrNotFound
+	} else if revision < 0 {
+		return ErrConflict
+	}
+	return s.save(revision)
+}
+
+// save saves the song, checking the current revision if `expected` isn't
+// negative
+func (s *Song) save(expected int) error {
 	if err := s.Check(); err != nil && s.ExternalID == "" {
-		return false
+		return err
 	}
 
 	if s.RowID == 0 && s.ExternalID != "" {
@@ -194,80 +254,102 @@ func (s *Song) Save() bool {
 		}
 		return &s
 	}
+	var tempo, scheduled, external any
+	if s.Tempo > 0 {
+		tempo = s.Tempo
+	}
+	if !s.LastScheduledAt.IsZero() {
+		scheduled = s.LastScheduledAt
+	}
+	if !s.ExternalUpdated.IsZero() {
+		external = s.ExternalUpdated
+	}
+
+	if !s.Creator.Valid() {
+		s.Creator = SystemUser()
+	}
+	if !s.LastMod.Valid() {
+		s.LastMod = SystemUser()
+	}
 
 	if s.RowID == 0 {
 		// insert
 		res, err := execQuery(`
-			insert into songs (external_id, title, author, ccli, content)
-			values (?, ?, ?, ?, ?);
-		`, p(s.ExternalID), p(s.Title), p(s.Author), p(s.CCLI), p(s.Content))
+			insert into songs (
+				external_id, title, author, ccli, content, creator, lastmod,
+				copyright, themes, admin, notes, musical_key, tempo, last_scheduled_at,
+				external_updated
+			)
+			values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+		`, p(s.ExternalID), p(s.Title), p(s.Author), p(s.CCLI), p(s.Content),
+			s.Creator.ID, s.LastMod.ID,
+			p(s.Copyright), p(s.Themes), p(s.Admin), p(s.Notes), p(s.Key), tempo, scheduled,
+			external,
+		)
 		if err == nil {
 			var id int64
 			id, err = res.LastInsertId()
 			s.RowID = int(id)
+			s.Revision = 1
 		}
 		if err == nil {
 			log.Info().Str("song", s.String()).Msg("inserted")
 		} else {
 			log.Err(err).Str("song", s.String()).Msg("inserting")
 		}
-		return err == nil
+		return err
 	}
 
 	// update
-	rows, err := execQuery(`
-		update songs set
-			external_id = ?,
-			title = ?,
-			author = ?,
-			ccli = ?,
-			content = ?,
-			modified = current_timestamp
-		where rowid = ?;
-	`, p(s.ExternalID), p(s.Title), p(s.Author), p(s.CCLI), p(s.Content),
-		s.RowID,
-	)
-	if err == nil {
-		var n int64
-		if n, err = rows.RowsAffected(); err == nil && n == 0 {
-			return false
-		}
-	}
-	if err != nil {
-		log.Err(err).Str("song", s.String()).Err(err).Msg("updating")
-		return false
-	}
-
-	log.Info().Str("song", s.String()).Err(err).Msg("updated")
-	s.Modified = time.Now()
-	return true
-}
-
-func LastModified(idPrefix string) time.Time {
-	def := time.Time{}
-	sql := `select max(modified) from songs`
-	if idPrefix != "" {
-		sql += fmt.Sprintf(` where external_id like '%s%%'`, idPrefix)
-	}
-	rows, err := runQuery(sql)
-	if err != nil {
-		log.Err(err).Msg("fetching lastmod")
-		return def
-	}
-	defer rows.Close()
-	if rows.Next() {
-		var timeStr *string
-		if err := rows.Scan(&timeStr); err != nil {
-			log.Fatal().Err(err).Msg("scanning lastmod")
+	err := withTx(func(tx *sql.Tx) error {
+		var current int
+		err := tx.QueryRow(`select revision from songs where rowid = ?`, s.RowID).Scan(&current)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		} else if expected >= 0 && current != expected {
+			return ErrConflict
 		}
 
-		if timeStr != nil {
-			t, err := time.Parse("2006-01-02 15:04:05", *timeStr)
-			if err != nil {
-				log.Err(err).Str("lastmod", *timeStr).Msg("bad lastmod")
-			}
-			return t
+		_, err = tx.Exec(`
+			update songs set
+				external_id = ?,
+				title = ?,
+				author = ?,
+				ccli = ?,
+				content = ?,
+				lastmod = ?,
+				modified = current_timestamp,
+				revision = ?,
+				copyright = ?,
+				themes = ?,
+				admin = ?,
+				notes = ?,
+				musical_key = ?,
+				tempo = ?,
+				last_scheduled_at = coalesce(?, last_scheduled_at),
+				external_updated = coalesce(?, external_updated)
+			where rowid = ?;
+		`, p(s.ExternalID), p(s.Title), p(s.Author), p(s.CCLI), p(s.Content),
+			s.LastMod.ID, current+1,
+			p(s.Copyright), p(s.Themes), p(s.Admin), p(s.Notes), p(s.Key), tempo, scheduled,
+			external, s.RowID,
+		)
+		if err == nil {
+			s.Revision = current + 1
 		}
+		return err
+	})
+	if err == ErrNotFound || err == ErrConflict {
+		log.Debug().Str("song", s.String()).Err(err).Msg("not updated")
+		return err
+	} else if err != nil {
+		log.Err(err).Str("song", s.String()).Msg("updating")
+		return err
 	}
-	return def
+
+	log.Info().Str("song", s.String()).Int("revision", s.Revision).Msg("updated")
+	s.Modified = time.Now()
+	return nil
 }
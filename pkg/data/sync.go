@@ -0,0 +1,42 @@
+package data
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SyncCursor returns up to when the source was synced, if it ever was
+func SyncCursor(source string) (time.Time, bool) {
+	rows, err := runQuery(`select cursor from sync_state where source = ?`, source)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer rows.Close()
+
+	var cursor time.Time
+	if !rows.Next() {
+		return cursor, false
+	}
+	if err := rows.Scan(&cursor); err != nil {
+		log.Err(err).Str("source", source).Msg("scanning sync cursor")
+		return cursor, false
+	}
+	return cursor, true
+}
+
+// SaveSyncCursor stores up to when the source was synced
+func SaveSyncCursor(source string, cursor time.Time) error {
+	_, err := execQuery(`
+		insert into sync_state (source, cursor, synced)
+		values (?, ?, current_timestamp)
+		on conflict(source)
+		do update set
+			cursor = excluded.cursor,
+			synced = excluded.synced;
+	`, source, cursor.UTC())
+	if err != nil {
+		return errCouldNotSave
+	}
+	return nil
+}
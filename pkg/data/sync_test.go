@@ -0,0 +1,54 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSyncCursor(t *testing.T) {
+	openTestDB(t)
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found := SyncCursor("pc:"); found {
+		t.Fatal("expected no cursor")
+	}
+
+	for _, cursor := range []time.Time{
+		time.Date(2022, 5, 1, 10, 30, 0, 0, time.UTC),
+		time.Date(2022, 5, 8, 9, 0, 0, 0, time.FixedZone("", 2*3600)),
+	} {
+		if err := SaveSyncCursor("pc:", cursor); err != nil {
+			t.Fatal(err)
+		}
+		if actual, found := SyncCursor("pc:"); !found || !actual.Equal(cursor) {
+			t.Errorf("expected cursor %v, but got %v", cursor, actual)
+		}
+	}
+}
+
+func TestExternalUpdated(t *testing.T) {
+	openTestDB(t)
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	updated := time.Date(2022, 5, 1, 10, 30, 0, 0, time.UTC)
+	song := Song{ExternalID: "pc:1", Title: "Grace", Content: "Amazing grace", ExternalUpdated: updated}
+	if !song.Save() {
+		t.Fatal("could not save song")
+	}
+	if saved := SongByExternalID("pc:1"); !saved.ExternalUpdated.Equal(updated) || saved.LastMod.ID != SystemUserID {
+		t.Errorf("bad imported song: %+v", saved)
+	}
+
+	// changing it locally keeps when it was changed on its source
+	edited := Song{RowID: song.RowID, ExternalID: "pc:1", Title: "Grace", Content: "How sweet", LastMod: User{ID: "ana", Name: "Ana"}}
+	if err := edited.SaveIf(1); err != nil {
+		t.Fatal(err)
+	}
+	if saved := SongByExternalID("pc:1"); !saved.ExternalUpdated.Equal(updated) || saved.LastMod.ID != "ana" {
+		t.Errorf("bad edited song: %+v", saved)
+	}
+}
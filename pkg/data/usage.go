@@ -0,0 +1,229 @@
+package data
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/paupin2/slides/pkg/slides"
+	"github.com/rs/zerolog/log"
+)
+
+// dateTitle matches the titles of decks for a day, like "2022-06-05"
+const dateTitle = `[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]`
+
+// deckSongIDs returns the ids of the songs on the deck's text, from headers
+// like "# Title (@12)", in order
+func deckSongIDs(text string) []int {
+	var ids []int
+	for _, line := range strings.Split(text, "\n") {
+		header, isTitle := slides.Title(strings.TrimSpace(line))
+		if !isTitle {
+			continue
+		}
+		if _, id, found := slides.SongRef(header); found {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// saveDeckSongs replaces the songs used on the deck
+func saveDeckSongs(tx *sql.Tx, title, text string) error {
+	if _, err := tx.Exec(`delete from deck_songs where title = ?`, title); err != nil {
+		return err
+	}
+	for i, id := range deckSongIDs(text) {
+		_, err := tx.Exec(`insert into deck_songs (title, position, song_id) values (?, ?, ?)`, title, i, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createDeckSongs creates the table of songs used on each deck, and fills
+// it from the existing decks
+func createDeckSongs(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		create table deck_songs (
+			title text not null,
+			position integer not null,
+			song_id integer not null,
+			primary key (title, position)
+		);
+		create index deck_songs_song on deck_songs (song_id, title);
+	`)
+	if err != nil {
+		return err
+	}
+	return fillDeckSongs(tx)
+}
+
+// fillDeckSongs sets the songs used on every existing deck
+func fillDeckSongs(tx *sql.Tx) error {
+	rows, err := tx.Query(`select title, coalesce(text, '') from decks`)
+	if err != nil {
+		return err
+	}
+	texts := map[string]string{}
+	for rows.Next() {
+		var title, text string
+		if err := rows.Scan(&title, &text); err != nil {
+			rows.Close()
+			return err
+		}
+		texts[title] = text
+	}
+	rows.Close()
+
+	for title, text := range texts {
+		if err := saveDeckSongs(tx, title, text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// today returns the title of today's deck
+func today() string {
+	return time.Now().Format("2006-01-02")
+}
+
+// SongUse is a deck where a song was used
+type SongUse struct {
+	Title    string `json:"title"`
+	Position int    `json:"position"` // the song's, among the deck's songs
+}
+
+// SongUsage returns the decks which used the song, newest first
+func SongUsage(songID int) []SongUse {
+	rows, err := runQuery(`
+		select title, position
+		from deck_songs
+		where song_id = ?
+		order by title desc, position
+	`, songID)
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	list := []SongUse{}
+	for rows.Next() {
+		var u SongUse
+		if err := rows.Scan(&u.Title, &u.Position); err != nil {
+			log.Err(err).Msg("scanning song usage")
+			return nil
+		}
+		list = append(list, u)
+	}
+	return list
+}
+
+// LastUsed returns the day each song was last used, up to today; songs
+// that weren't used aren't included
+func LastUsed() map[int]string {
+	rows, err := runQuery(`
+		select song_id, max(title)
+		from deck_songs
+		where title glob '`+dateTitle+`' and title <= ?
+		group by song_id
+	`, today())
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	last := map[int]string{}
+	for rows.Next() {
+		var (
+			id  int
+			day string
+		)
+		if err := rows.Scan(&id, &day); err != nil {
+			log.Err(err).Msg("scanning last used")
+			return nil
+		}
+		last[id] = day
+	}
+	return last
+}
+
+// UnusedSong is a song that wasn't used for a while
+type UnusedSong struct {
+	ID       int    `json:"id"`
+	Title    string `json:"title"`
+	LastUsed string `json:"last_used,omitempty"` // empty if never used
+}
+
+// SongsUnusedSince returns the songs not used on any day since `since`,
+// least recently used first
+func SongsUnusedSince(since time.Time) []UnusedSong {
+	rows, err := runQuery(`
+		select S.rowid, coalesce(S.title, ''), coalesce(max(DS.title), '')
+		from songs S
+		left join deck_songs DS on (
+			DS.song_id = S.rowid
+			and DS.title glob '`+dateTitle+`'
+			and DS.title <= ?
+		)
+		group by S.rowid
+		having coalesce(max(DS.title), '') < ?
+		order by 3, 2
+	`, today(), since.Format("2006-01-02"))
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	list := []UnusedSong{}
+	for rows.Next() {
+		var s UnusedSong
+		if err := rows.Scan(&s.ID, &s.Title, &s.LastUsed); err != nil {
+			log.Err(err).Msg("scanning unused songs")
+			return nil
+		}
+		list = append(list, s)
+	}
+	return list
+}
+
+// SongCount is how many days a song was used on
+type SongCount struct {
+	ID     int    `json:"id"`
+	Title  string `json:"title"`
+	Author string `json:"author,omitempty"`
+	CCLI   string `json:"ccli,omitempty"`
+	Count  int    `json:"count"`
+}
+
+// SongCounts returns how many days each song was used on, from `from` to
+// `to` (inclusive), by title. Songs with the same CCLI number (like one
+// imported and a copy made by hand) are the same song, and counted once,
+// with the details of the first one.
+func SongCounts(from, to time.Time) []SongCount {
+	rows, err := runQuery(`
+		select min(S.rowid), coalesce(S.title, ''), coalesce(S.author, ''), trim(coalesce(S.ccli, '')), count(distinct DS.title)
+		from deck_songs DS
+		join songs S on (S.rowid = DS.song_id)
+		where DS.title glob '`+dateTitle+`' and DS.title between ? and ?
+		group by case when trim(coalesce(S.ccli, '')) = '' then 'song ' || S.rowid else trim(S.ccli) end
+		order by 2, 1
+	`, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	list := []SongCount{}
+	for rows.Next() {
+		var c SongCount
+		if err := rows.Scan(&c.ID, &c.Title, &c.Author, &c.CCLI, &c.Count); err != nil {
+			log.Err(err).Msg("scanning song counts")
+			return nil
+		}
+		list = append(list, c)
+	}
+	return list
+}
@@ -0,0 +1,114 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSongUsage(t *testing.T) {
+	openTestDB(t)
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int
+	for _, title := range []string{"Grace", "Holy", "Never sung"} {
+		s := Song{Title: title, Content: "la la"}
+		if !s.Save() {
+			t.Fatal("could not save song")
+		}
+		ids = append(ids, s.RowID)
+	}
+	grace, holy, never := ids[0], ids[1], ids[2]
+
+	future := time.Now().AddDate(0, 0, 7).Format("2006-01-02")
+	for title, text := range map[string]string{
+		"2022-05-01": "# Grace (@1)\nla\n\n# Holy (@2)\nla",
+		"2022-06-05": "# Holy (@2)\nla",
+		"Christmas":  "# Grace (@1)\nla",
+		future:       "# Grace (@1)\nla",
+	} {
+		d := Deck{Title: title, Text: text}
+		if err := d.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if uses := SongUsage(grace); len(uses) != 3 || uses[0].Title != "Christmas" || uses[2].Title != "2022-05-01" {
+		t.Errorf("bad usage: %+v", uses)
+	}
+	if uses := SongUsage(holy); len(uses) != 2 || uses[1].Position != 1 {
+		t.Errorf("bad usage: %+v", uses)
+	}
+
+	// only days up to today count
+	last := LastUsed()
+	if last[grace] != "2022-05-01" || last[holy] != "2022-06-05" || last[never] != "" {
+		t.Errorf("bad last used: %+v", last)
+	}
+	unused := SongsUnusedSince(time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC))
+	if len(unused) != 2 || unused[0].ID != never || unused[1].ID != grace || unused[1].LastUsed != "2022-05-01" {
+		t.Errorf("bad unused songs: %+v", unused)
+	}
+
+	// songs used twice on the same day count once
+	d := Deck{Title: "2022-06-12", Text: "# Holy (@2)\nla\n\n# Holy (@2)\nla"}
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+	counts := SongCounts(time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2022, 6, 12, 0, 0, 0, 0, time.UTC))
+	if len(counts) != 2 || counts[0].Title != "Grace" || counts[0].Count != 1 || counts[1].Title != "Holy" || counts[1].Count != 3 {
+		t.Errorf("bad counts: %+v", counts)
+	}
+	if err := d.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	// songs with the same CCLI number are the same song, even on the same day
+	for _, id := range []int{grace, holy} {
+		s := SongByID(id)
+		s.CCLI = " 22025"
+		if !s.Save() {
+			t.Fatal("could not save song")
+		}
+	}
+	counts = SongCounts(time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2022, 6, 5, 0, 0, 0, 0, time.UTC))
+	if len(counts) != 1 || counts[0].ID != grace || counts[0].Title != "Grace" || counts[0].CCLI != "22025" || counts[0].Count != 2 {
+		t.Errorf("bad counts by CCLI number: %+v", counts)
+	}
+
+	// changing or deleting decks updates the usage
+	d, _ = LoadDeck("2022-06-05")
+	d.Text = "# Grace (@1)"
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if list := ListDecks(""); len(list) != 4 || list[1].Title != "2022-06-05" || len(list[1].Songs) != 1 || list[1].Songs[0] != grace {
+		t.Errorf("bad deck list: %+v", list)
+	}
+	if err := d.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if uses := SongUsage(holy); len(uses) != 1 {
+		t.Errorf("bad usage after deleting: %+v", uses)
+	}
+
+	// existing decks are added when migrating
+	if _, err := db.Exec(`drop table deck_songs; delete from schema_version where version = 8`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if uses := SongUsage(grace); len(uses) != 3 {
+		t.Errorf("bad usage after migrating: %+v", uses)
+	}
+}
+
+func TestDeckSongIDs(t *testing.T) {
+	// the same references the slides find, and no others
+	ids := deckSongIDs("# Grace (@1)\nla\n\n  ## Holy (@2) \nla\n\n# Grace (@1) short\nla\n\nla (@3)\n\n# Grace (@1)")
+	if len(ids) != 3 || ids[0] != 1 || ids[1] != 2 || ids[2] != 1 {
+		t.Errorf("bad song ids: %v", ids)
+	}
+}
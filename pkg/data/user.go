@@ -1,12 +1,24 @@
 package data
 
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
 type User struct {
 	ID   string `json:"-"`
 	Name string `json:"name"`
 }
 
 func (u User) Valid() bool {
-	return u.ID != "" && CheckTitle(u.Name) == nil
+	return u.ID != "" && strings.TrimSpace(u.Name) != ""
 }
 
 func UnusedUserID() string {
@@ -25,3 +37,151 @@ func UnusedUserID() string {
 		return id
 	}
 }
+
+const (
+	minPasswordLength = 8
+
+	// SessionDuration is how long users stay logged in
+	SessionDuration = 30 * 24 * time.Hour
+)
+
+var (
+	errBadUsername = errors.New("bad username")
+	errBadPassword = errors.New("password is too short")
+
+	// used to compare passwords for unknown users, so that logging in
+	// takes the same time whether the user exists or not
+	dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+)
+
+// SaveUser creates or updates the user, setting its password. If the name
+// is empty, an existing user keeps its name.
+func SaveUser(u User, passwd string) error {
+	if u.ID == "" || u.ID == SystemUserID || u.ID != strings.TrimSpace(u.ID) {
+		return errBadUsername
+	} else if len(passwd) < minPasswordLength {
+		return errBadPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(passwd), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	// new users without a name are named after their username
+	newName := u.Name
+	if newName == "" {
+		newName = u.ID
+	}
+	_, err = execQuery(`
+		insert into users (username, name, passwd)
+		values (?, ?, ?)
+		on conflict(username)
+		do update set
+			name = coalesce(nullif(?, ''), users.name),
+			passwd = excluded.passwd;
+	`, u.ID, newName, string(hash), u.Name)
+	if err != nil {
+		log.Debug().Str("user", u.ID).Err(err).Msg("could not save user")
+		return errCouldNotSave
+	}
+	log.Info().Str("user", u.ID).Msg("saved user")
+	return nil
+}
+
+// Authenticate returns the user, if the password matches
+func Authenticate(username, passwd string) (User, bool) {
+	rows, err := runQuery(`select username, name, passwd from users where username = ?`, username)
+	if err != nil {
+		return User{}, false
+	}
+	defer rows.Close()
+
+	var (
+		u    User
+		hash *string
+	)
+	if rows.Next() {
+		if err := rows.Scan(&u.ID, &u.Name, &hash); err != nil {
+			log.Err(err).Msg("scanning user")
+			return User{}, false
+		}
+	}
+
+	if hash == nil {
+		// unknown user, or without password (eg: the system user)
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(passwd))
+		return User{}, false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(*hash), []byte(passwd)) != nil {
+		return User{}, false
+	}
+	return u, true
+}
+
+// hashToken returns what's stored on the db for a session token, so that
+// the tokens themselves are only known to the browsers
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newToken returns a random, hard to guess, token
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// NewSession starts a session for the user, returning its token
+func NewSession(u User) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = execQuery(`
+		insert into sessions (token, username, expires)
+		values (?, ?, ?);
+	`, hashToken(token), u.ID, time.Now().UTC().Add(SessionDuration))
+	if err != nil {
+		return "", errCouldNotSave
+	}
+
+	// remove expired sessions
+	_, _ = execQuery(`delete from sessions where expires < ?`, time.Now().UTC())
+	return token, nil
+}
+
+// SessionUser returns the user of a valid session
+func SessionUser(token string) (User, bool) {
+	rows, err := runQuery(`
+		select U.username, U.name
+		from sessions S
+		join users U on (U.username = S.username)
+		where S.token = ? and S.expires > ?
+		limit 1;
+	`, hashToken(token), time.Now().UTC())
+	if err != nil {
+		return User{}, false
+	}
+	defer rows.Close()
+
+	var u User
+	if !rows.Next() {
+		return u, false
+	}
+	if err := rows.Scan(&u.ID, &u.Name); err != nil {
+		log.Err(err).Msg("scanning session")
+		return u, false
+	}
+	return u, true
+}
+
+// EndSession logs the session's user out
+func EndSession(token string) error {
+	_, err := execQuery(`delete from sessions where token = ?`, hashToken(token))
+	return err
+}
@@ -0,0 +1,33 @@
+package data
+
+import "testing"
+
+func TestSaveUser(t *testing.T) {
+	openTestDB(t)
+	if _, err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SaveUser(User{ID: "ana", Name: "Ana Lima"}, "first password"); err != nil {
+		t.Fatal(err)
+	}
+
+	// changing only the password keeps the name
+	if err := SaveUser(User{ID: "ana"}, "second password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Authenticate("ana", "first password"); ok {
+		t.Error("the old password still works")
+	}
+	if u, ok := Authenticate("ana", "second password"); !ok || u.Name != "Ana Lima" {
+		t.Errorf("bad user after changing the password: %+v, %v", u, ok)
+	}
+
+	// new users without a name are named after their username
+	if err := SaveUser(User{ID: "bob"}, "bob's password"); err != nil {
+		t.Fatal(err)
+	}
+	if u, ok := Authenticate("bob", "bob's password"); !ok || u.Name != "bob" {
+		t.Errorf("bad new user: %+v, %v", u, ok)
+	}
+}
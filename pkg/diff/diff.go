@@ -0,0 +1,108 @@
+// Package diff compares texts line by line
+package diff
+
+import (
+	"strings"
+)
+
+const (
+	Same    = "="
+	Added   = "+"
+	Removed = "-"
+)
+
+// Line is a line of a diff
+type Line struct {
+	Op   string `json:"op"` // Same, Added or Removed
+	Text string `json:"text"`
+}
+
+// Lines returns the lines to remove from `a` and add to it to get `b`,
+// using the longest common subsequence of lines.
+func Lines(a, b string) []Line {
+	as, bs := split(a), split(b)
+
+	// skip the common prefix and suffix
+	prefix := 0
+	for prefix < len(as) && prefix < len(bs) && as[prefix] == bs[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(as)-prefix && suffix < len(bs)-prefix &&
+		as[len(as)-1-suffix] == bs[len(bs)-1-suffix] {
+		suffix++
+	}
+
+	result := make([]Line, 0, len(as)+len(bs))
+	for _, s := range as[:prefix] {
+		result = append(result, Line{Same, s})
+	}
+	result = append(result, lcs(as[prefix:len(as)-suffix], bs[prefix:len(bs)-suffix])...)
+	for _, s := range as[len(as)-suffix:] {
+		result = append(result, Line{Same, s})
+	}
+	return result
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+func lcs(as, bs []string) []Line {
+	// lengths[i][j] is the length of the LCS of as[i:] and bs[j:]
+	lengths := make([][]int, len(as)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(bs)+1)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		for j := len(bs) - 1; j >= 0; j-- {
+			if as[i] == bs[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	var result []Line
+	i, j := 0, 0
+	for i < len(as) && j < len(bs) {
+		switch {
+		case as[i] == bs[j]:
+			result = append(result, Line{Same, as[i]})
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			result = append(result, Line{Removed, as[i]})
+			i++
+		default:
+			result = append(result, Line{Added, bs[j]})
+			j++
+		}
+	}
+	for ; i < len(as); i++ {
+		result = append(result, Line{Removed, as[i]})
+	}
+	for ; j < len(bs); j++ {
+		result = append(result, Line{Added, bs[j]})
+	}
+	return result
+}
+
+// Unified returns the diff as text, with each line prefixed by its op
+func Unified(lines []Line) string {
+	var b strings.Builder
+	for _, l := range lines {
+		op := l.Op
+		if op == Same {
+			op = " "
+		}
+		b.WriteString(op + l.Text + "\n")
+	}
+	return b.String()
+}
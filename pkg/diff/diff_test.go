@@ -0,0 +1,20 @@
+package diff
+
+import "testing"
+
+func TestLines(t *testing.T) {
+	check := func(a, b, expected string) {
+		t.Helper()
+		if actual := Unified(Lines(a, b)); actual != expected {
+			t.Errorf("diffing %q and %q\nexpected:\n%s\nbut got:\n%s", a, b, expected, actual)
+		}
+	}
+
+	check("", "", "")
+	check("a\nb\n", "a\nb", " a\n b\n")
+	check("", "a\nb", "+a\n+b\n")
+	check("a\nb", "", "-a\n-b\n")
+	check("a\nb\nc\nd", "a\nx\nc\nd\ne", " a\n-b\n+x\n c\n d\n+e\n")
+	check("# Verse\none\ntwo\n\n# Chorus\nthree", "# Chorus\nthree\n\n# Verse\none\ntwo",
+		"+# Chorus\n+three\n+\n # Verse\n one\n two\n-\n-# Chorus\n-three\n")
+}
@@ -0,0 +1,270 @@
+// Package export renders decks for printing
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/paupin2/slides/pkg/data"
+	"github.com/paupin2/slides/pkg/slides"
+)
+
+const (
+	LayoutSlides  = "slides"  // one slide per page, like on the screen
+	LayoutBooklet = "booklet" // slides one after the other, on small pages
+)
+
+// ValidLayout returns true if the layout is supported
+func ValidLayout(layout string) bool {
+	return layout == LayoutSlides || layout == LayoutBooklet
+}
+
+// song is a song referenced on the deck
+type song struct {
+	Title  string
+	Footer string // author and CCLI number
+}
+
+// block is a slide, with the song it belongs to
+type block struct {
+	slides.Slide
+	Song     *song
+	NewSong  bool     // first slide of the song
+	Sections []string // headers other than the song title
+	Lines    []string
+}
+
+// blocks parses the deck, and finds each slide's song on its headers
+func blocks(text string, load func(id int) *data.Song) []block {
+	var (
+		result  []block
+		current *song
+	)
+	for _, s := range slides.Parse(text) {
+		b := block{Slide: s}
+		for _, h := range s.Headers {
+			title, id, found := slides.SongRef(h)
+			if !found {
+				b.Sections = append(b.Sections, h)
+				continue
+			}
+
+			current = &song{Title: title}
+			if ds := load(id); ds != nil {
+				current.Footer = footer(ds)
+			}
+			b.NewSong = true
+		}
+		b.Song = current
+
+		lines := strings.Split(s.Text, "\n")
+		if s.Subtitle {
+			lines = lines[1:]
+		}
+		for _, l := range lines {
+			b.Lines = append(b.Lines, strings.TrimSpace(l))
+		}
+		result = append(result, b)
+	}
+	return result
+}
+
+func footer(s *data.Song) string {
+	var parts []string
+	if s.Author != "" {
+		parts = append(parts, s.Author)
+	}
+	if s.CCLI != "" {
+		parts = append(parts, "CCLI #"+s.CCLI)
+	}
+	return strings.Join(parts, " · ")
+}
+
+func loadSong(id int) *data.Song {
+	return data.SongByID(id)
+}
+
+// PDF writes the deck as a PDF using the layout
+func PDF(w io.Writer, deck data.Deck, layout string) error {
+	var pdf *fpdf.Fpdf
+	bs := blocks(deck.Text, loadSong)
+	switch layout {
+	case LayoutSlides:
+		pdf = slidesPDF(deck.Title, bs)
+	case LayoutBooklet:
+		pdf = bookletPDF(deck.Title, bs)
+	default:
+		return fmt.Errorf("bad layout %q", layout)
+	}
+	pdf.SetTitle(deck.Title, true)
+	pdf.SetCreator("slides", true)
+	return pdf.Output(w)
+}
+
+const (
+	gray = 120
+	ptMM = 0.3528 // a point, in mm
+)
+
+// wrap splits the (already translated) line on words, so that each part
+// fits the width. fpdf's SplitText expects UTF-8, which core fonts don't use.
+func wrap(pdf *fpdf.Fpdf, line string, width float64) []string {
+	var (
+		lines []string
+		cur   string
+	)
+	for _, word := range strings.Fields(line) {
+		if cur != "" && pdf.GetStringWidth(cur+" "+word) > width {
+			lines = append(lines, cur)
+			cur = ""
+		}
+		if cur != "" {
+			cur += " "
+		}
+		cur += word
+	}
+	return append(lines, cur)
+}
+
+// slidesPDF renders each slide on a landscape page, with the text as big
+// as it fits
+func slidesPDF(title string, bs []block) *fpdf.Fpdf {
+	pdf := fpdf.New("L", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	const margin = 20.0
+	pw, ph := pdf.GetPageSize()
+	tw := pw - 2*margin
+	top, bottom := 30.0, ph-25
+
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(false, 0)
+	if len(bs) == 0 {
+		pdf.AddPage()
+	}
+
+	for i, b := range bs {
+		pdf.AddPage()
+
+		// headers
+		pdf.SetTextColor(gray, gray, gray)
+		pdf.SetFont("Helvetica", "", 12)
+		pdf.SetXY(margin, 12)
+		var headers []string
+		if b.NewSong {
+			headers = append(headers, b.Song.Title)
+		}
+		pdf.CellFormat(tw, 6, tr(strings.Join(append(headers, b.Sections...), " / ")), "", 0, "L", false, 0, "")
+
+		// text: the biggest font where all lines fit
+		pdf.SetTextColor(0, 0, 0)
+		var lines []string
+		var lh float64
+		for size := 36.0; size >= 10; size -= 2 {
+			pdf.SetFont("Helvetica", "", size)
+			lh = size * ptMM * 1.4
+			lines = lines[:0]
+			for _, l := range b.Lines {
+				lines = append(lines, wrap(pdf, tr(l), tw)...)
+			}
+			if float64(len(lines))*lh <= bottom-top {
+				break
+			}
+		}
+		y := top + (bottom-top-float64(len(lines))*lh)/2
+		for _, l := range lines {
+			pdf.SetXY(margin, y)
+			pdf.CellFormat(tw, lh, l, "", 0, "C", false, 0, "")
+			y += lh
+		}
+
+		// footer
+		pdf.SetTextColor(gray, gray, gray)
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.SetXY(margin, ph-15)
+		if b.Song != nil {
+			pdf.CellFormat(tw*3/4, 5, tr(strings.Trim(b.Song.Title+" · "+b.Song.Footer, " ·")), "", 0, "L", false, 0, "")
+		}
+		pdf.SetXY(margin+tw*3/4, ph-15)
+		pdf.CellFormat(tw/4, 5, tr(fmt.Sprintf("%s  %d/%d", title, i+1, len(bs))), "", 0, "R", false, 0, "")
+	}
+	return pdf
+}
+
+// bookletPDF renders the slides one after the other, on A5 pages
+func bookletPDF(title string, bs []block) *fpdf.Fpdf {
+	pdf := fpdf.New("P", "mm", "A5", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	const (
+		margin = 12.0
+		lh     = 4.6
+	)
+	pw, ph := pdf.GetPageSize()
+	tw := pw - 2*margin
+
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(true, margin+6)
+	pdf.AliasNbPages("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-margin - 2)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.SetTextColor(gray, gray, gray)
+		pdf.CellFormat(tw, 4, tr(fmt.Sprintf("%s  %d/{nb}", title, pdf.PageNo())), "", 0, "R", false, 0, "")
+	})
+	pdf.AddPage()
+
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(tw, 8, tr(title), "", 1, "L", false, 0, "")
+	pdf.Ln(2)
+
+	songFooter := func(s *song) {
+		if s == nil || s.Footer == "" {
+			return
+		}
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.SetTextColor(gray, gray, gray)
+		pdf.MultiCell(tw, 4, tr(s.Footer), "", "L", false)
+	}
+
+	var current *song
+	for _, b := range bs {
+		if b.NewSong {
+			songFooter(current)
+			current = b.Song
+			pdf.Ln(3)
+		}
+
+		// keep the slide on a single page, if it fits
+		pdf.SetFont("Helvetica", "", 10)
+		height := 0.0
+		for _, l := range b.Lines {
+			height += float64(len(wrap(pdf, tr(l), tw))) * lh
+		}
+		if b.NewSong {
+			height += 7
+		}
+		height += float64(len(b.Sections)) * 4.5
+		if pdf.GetY()+height > ph-margin-6 && height < ph-2*margin {
+			pdf.AddPage()
+		}
+
+		if b.NewSong {
+			pdf.SetFont("Helvetica", "B", 12)
+			pdf.SetTextColor(0, 0, 0)
+			pdf.MultiCell(tw, 6, tr(b.Song.Title), "", "L", false)
+			pdf.Ln(1)
+		}
+		for _, h := range b.Sections {
+			pdf.SetFont("Helvetica", "I", 9)
+			pdf.SetTextColor(gray, gray, gray)
+			pdf.MultiCell(tw, 4.5, tr(h), "", "L", false)
+		}
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.SetTextColor(0, 0, 0)
+		pdf.MultiCell(tw, lh, tr(strings.Join(b.Lines, "\n")), "", "L", false)
+		pdf.Ln(2.5)
+	}
+	songFooter(current)
+	return pdf
+}
@@ -0,0 +1,54 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/paupin2/slides/pkg/data"
+)
+
+func TestBlocks(t *testing.T) {
+	load := func(id int) *data.Song {
+		if id == 2 {
+			return &data.Song{Author: "John Newton", CCLI: "22025"}
+		}
+		return nil
+	}
+	bs := blocks("# Welcome\nhi\n\n# Amazing Grace (@2)\n# Verse\none\ntwo\n\n_\nthree\n\n# Other (@9)\nfour", load)
+	if len(bs) != 4 {
+		t.Fatalf("expected 4 blocks, but got %d", len(bs))
+	}
+
+	if b := bs[0]; b.Song != nil || b.NewSong || len(b.Sections) != 1 {
+		t.Errorf("bad first block: %+v", b)
+	}
+	if b := bs[1]; !b.NewSong || b.Song.Title != "Amazing Grace" || b.Song.Footer != "John Newton · CCLI #22025" ||
+		len(b.Sections) != 1 || b.Sections[0] != "Verse" || len(b.Lines) != 2 {
+		t.Errorf("bad second block: %+v", b)
+	}
+	if b := bs[2]; b.NewSong || b.Song != bs[1].Song || len(b.Lines) != 1 || b.Lines[0] != "three" {
+		t.Errorf("bad subtitle block: %+v", b)
+	}
+	if b := bs[3]; !b.NewSong || b.Song.Title != "Other" || b.Song.Footer != "" {
+		t.Errorf("bad last block: %+v", b)
+	}
+}
+
+func TestLayouts(t *testing.T) {
+	text := "# Song (@1)\nÅh vad härligt\n\n" + strings.Repeat("a long line of lyrics\n", 60)
+	bs := blocks(text, func(int) *data.Song { return nil })
+	for _, pdf := range []*fpdf.Fpdf{
+		slidesPDF("2022-06-05", bs),
+		bookletPDF("2022-06-05", bs),
+		bookletPDF("empty", nil),
+	} {
+		var buf bytes.Buffer
+		if err := pdf.Output(&buf); err != nil {
+			t.Error(err)
+		} else if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF")) {
+			t.Error("not a pdf")
+		}
+	}
+}
@@ -0,0 +1,399 @@
+// Package obs shows the slides on OBS Studio, using the obs-websocket v5
+// protocol: it sets the text of a text source, and hides it (or switches
+// scenes) when the screen is cleared.
+//
+// See: https://github.com/obsproject/obs-websocket/blob/master/docs/generated/protocol.md
+package obs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/paupin2/slides/pkg/config"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	opHello      = 0
+	opIdentify   = 1
+	opIdentified = 2
+	opRequest    = 6
+	opResponse   = 7
+
+	rpcVersion  = 1
+	subprotocol = "obswebsocket.json"
+)
+
+var (
+	// Timeout is how long to wait for OBS to reply
+	Timeout = 5 * time.Second
+	// RetryDelay is how long to wait before reconnecting
+	RetryDelay = 5 * time.Second
+)
+
+type message struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d"`
+}
+
+type hello struct {
+	RPCVersion     int `json:"rpcVersion"`
+	Authentication *struct {
+		Challenge string `json:"challenge"`
+		Salt      string `json:"salt"`
+	} `json:"authentication"`
+}
+
+type identify struct {
+	RPCVersion         int    `json:"rpcVersion"`
+	Authentication     string `json:"authentication,omitempty"`
+	EventSubscriptions int    `json:"eventSubscriptions"`
+}
+
+type request struct {
+	RequestType string      `json:"requestType"`
+	RequestID   string      `json:"requestId"`
+	RequestData interface{} `json:"requestData,omitempty"`
+}
+
+type response struct {
+	RequestType   string `json:"requestType"`
+	RequestID     string `json:"requestId"`
+	RequestStatus struct {
+		Result  bool   `json:"result"`
+		Code    int    `json:"code"`
+		Comment string `json:"comment"`
+	} `json:"requestStatus"`
+	ResponseData json.RawMessage `json:"responseData"`
+}
+
+// auth returns the authentication string for the password
+func auth(password, salt, challenge string) string {
+	hash := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return base64.StdEncoding.EncodeToString(sum[:])
+	}
+	return hash(hash(password+salt) + challenge)
+}
+
+// State is what should be shown on OBS
+type State struct {
+	Text  string
+	Blank bool
+}
+
+// Client keeps OBS in sync with the screens of a deck
+type Client struct {
+	cfg    config.OBS
+	lock   sync.Mutex
+	notify chan struct{}
+	queued *State // what to send next, if anything
+	sent   *State // what was last sent, to send again after reconnecting
+}
+
+// New creates a client; call Run to connect
+func New(cfg config.OBS) *Client {
+	return &Client{
+		cfg:    cfg,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// Show queues what the deck's screens show to be sent to OBS. It never
+// blocks: if OBS is slow, only the latest state is sent.
+func (c *Client) Show(deck string, st State) {
+	if c.cfg.Deck != "" && deck != c.cfg.Deck {
+		return
+	}
+
+	c.lock.Lock()
+	c.queued = &st
+	c.lock.Unlock()
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// next returns the queued state, if any
+func (c *Client) next() *State {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	st := c.queued
+	c.queued = nil
+	return st
+}
+
+// requeue queues the state again, unless there's a newer one
+func (c *Client) requeue(st *State) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.queued == nil {
+		c.queued = st
+	}
+}
+
+// Run connects to OBS and sends it the updates, reconnecting as needed,
+// until the context is done
+func (c *Client) Run(ctx context.Context) {
+	failing := false
+	for ctx.Err() == nil {
+		err := c.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		msg := log.Warn()
+		if failing {
+			msg = log.Debug()
+		}
+		msg.Err(err).Str("address", c.cfg.Address).Msg("obs disconnected")
+		failing = true
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(RetryDelay):
+		}
+	}
+}
+
+// conn is a connection to OBS
+type conn struct {
+	ws        *websocket.Conn
+	responses chan response
+	done      chan struct{} // closed when reading fails
+	err       error
+	lastID    int
+	itemIDs   map[string]int // scene item ids, by "scene/source"
+}
+
+// connect opens a connection to OBS and identifies to it
+func (c *Client) connect(ctx context.Context) (*conn, error) {
+	dialer := websocket.Dialer{
+		HandshakeTimeout: Timeout,
+		Subprotocols:     []string{subprotocol},
+	}
+	ws, _, err := dialer.DialContext(ctx, c.cfg.Address, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	read := func(op int, v interface{}) error {
+		var msg message
+		_ = ws.SetReadDeadline(time.Now().Add(Timeout))
+		if err := ws.ReadJSON(&msg); err != nil {
+			return err
+		} else if msg.Op != op {
+			return fmt.Errorf("expected op %d, but got %d", op, msg.Op)
+		}
+		return json.Unmarshal(msg.D, v)
+	}
+
+	var h hello
+	if err := read(opHello, &h); err != nil {
+		ws.Close()
+		return nil, err
+	}
+	id := identify{RPCVersion: rpcVersion}
+	if a := h.Authentication; a != nil {
+		id.Authentication = auth(c.cfg.Password, a.Salt, a.Challenge)
+	}
+	d, _ := json.Marshal(id)
+	if err := ws.WriteJSON(message{Op: opIdentify, D: d}); err != nil {
+		ws.Close()
+		return nil, err
+	}
+	var identified struct{}
+	if err := read(opIdentified, &identified); err != nil {
+		ws.Close()
+		return nil, fmt.Errorf("identifying: %w", err)
+	}
+	_ = ws.SetReadDeadline(time.Time{})
+
+	cn := &conn{
+		ws:        ws,
+		responses: make(chan response, 1),
+		done:      make(chan struct{}),
+		itemIDs:   map[string]int{},
+	}
+	go cn.readLoop()
+	log.Info().Str("address", c.cfg.Address).Msg("obs connected")
+	return cn, nil
+}
+
+// readLoop reads the responses (and ignores events) until the connection
+// is closed
+func (cn *conn) readLoop() {
+	defer close(cn.done)
+	for {
+		var msg message
+		if cn.err = cn.ws.ReadJSON(&msg); cn.err != nil {
+			return
+		} else if msg.Op != opResponse {
+			continue
+		}
+
+		var resp response
+		if err := json.Unmarshal(msg.D, &resp); err != nil {
+			log.Warn().Err(err).Msg("bad obs response")
+			continue
+		}
+		select {
+		case cn.responses <- resp:
+		case <-time.After(Timeout):
+			// no one is waiting for it anymore
+		}
+	}
+}
+
+// request sends a request, and waits for its response data
+func (cn *conn) request(requestType string, data interface{}, reply interface{}) error {
+	cn.lastID++
+	req := request{
+		RequestType: requestType,
+		RequestID:   strconv.Itoa(cn.lastID),
+		RequestData: data,
+	}
+	d, _ := json.Marshal(req)
+	_ = cn.ws.SetWriteDeadline(time.Now().Add(Timeout))
+	if err := cn.ws.WriteJSON(message{Op: opRequest, D: d}); err != nil {
+		return err
+	}
+
+	timeout := time.After(Timeout)
+	for {
+		select {
+		case resp := <-cn.responses:
+			if resp.RequestID != req.RequestID {
+				continue // late response to an older request
+			} else if !resp.RequestStatus.Result {
+				return fmt.Errorf("%s failed (%d): %s", requestType,
+					resp.RequestStatus.Code, resp.RequestStatus.Comment)
+			} else if reply != nil {
+				return json.Unmarshal(resp.ResponseData, reply)
+			}
+			return nil
+		case <-cn.done:
+			return cn.err
+		case <-timeout:
+			return errors.New(requestType + " timed out")
+		}
+	}
+}
+
+// itemID returns the id of the source on the scene
+func (cn *conn) itemID(scene, source string) (int, error) {
+	key := scene + "/" + source
+	if id, found := cn.itemIDs[key]; found {
+		return id, nil
+	}
+
+	var reply struct {
+		SceneItemID int `json:"sceneItemId"`
+	}
+	err := cn.request("GetSceneItemId", map[string]interface{}{
+		"sceneName":  scene,
+		"sourceName": source,
+	}, &reply)
+	if err != nil {
+		return 0, err
+	}
+	cn.itemIDs[key] = reply.SceneItemID
+	return reply.SceneItemID, nil
+}
+
+// apply changes OBS to show the state
+func (c *Client) apply(cn *conn, st State) error {
+	cfg := c.cfg
+	toggles := cfg.LyricsSource != "" || cfg.LyricsScene != "" || cfg.ClearScene != ""
+	if cfg.TextSource != "" && (!st.Blank || !toggles) {
+		// when hiding the source, keep the text so that it fades out
+		err := cn.request("SetInputSettings", map[string]interface{}{
+			"inputName":     cfg.TextSource,
+			"inputSettings": map[string]string{"text": st.Text},
+			"overlay":       true,
+		}, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.LyricsSource != "" {
+		scene := cfg.Scene
+		if scene == "" {
+			var reply struct {
+				Name string `json:"currentProgramSceneName"`
+			}
+			if err := cn.request("GetCurrentProgramScene", nil, &reply); err != nil {
+				return err
+			}
+			scene = reply.Name
+		}
+		id, err := cn.itemID(scene, cfg.LyricsSource)
+		if err != nil {
+			return err
+		}
+		return cn.request("SetSceneItemEnabled", map[string]interface{}{
+			"sceneName":        scene,
+			"sceneItemId":      id,
+			"sceneItemEnabled": !st.Blank,
+		}, nil)
+	}
+
+	scene := cfg.LyricsScene
+	if st.Blank {
+		scene = cfg.ClearScene
+	}
+	if scene != "" {
+		return cn.request("SetCurrentProgramScene", map[string]interface{}{
+			"sceneName": scene,
+		}, nil)
+	}
+	return nil
+}
+
+// session connects to OBS, and sends it updates until the connection fails
+func (c *Client) session(ctx context.Context) error {
+	cn, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer cn.ws.Close()
+
+	// after reconnecting, OBS may have been changed
+	c.lock.Lock()
+	if c.queued == nil {
+		c.queued = c.sent
+	}
+	c.lock.Unlock()
+
+	for {
+		if st := c.next(); st != nil {
+			if err := c.apply(cn, *st); err != nil {
+				c.requeue(st)
+				return err
+			}
+			c.lock.Lock()
+			c.sent = st
+			c.lock.Unlock()
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-cn.done:
+			return cn.err
+		case <-c.notify:
+		}
+	}
+}
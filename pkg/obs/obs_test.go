@@ -0,0 +1,165 @@
+package obs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/paupin2/slides/pkg/config"
+)
+
+// fakeOBS is a minimal obs-websocket server, which records the requests
+type fakeOBS struct {
+	*httptest.Server
+	password string
+	requests chan request
+}
+
+func newFakeOBS(t *testing.T, password string) *fakeOBS {
+	f := &fakeOBS{password: password, requests: make(chan request, 100)}
+	upgrader := websocket.Upgrader{Subprotocols: []string{subprotocol}}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer ws.Close()
+
+		send := func(op int, v interface{}) {
+			d, _ := json.Marshal(v)
+			_ = ws.WriteJSON(message{Op: op, D: d})
+		}
+		send(opHello, map[string]interface{}{
+			"obsWebSocketVersion": "5.0.0",
+			"rpcVersion":          rpcVersion,
+			"authentication":      map[string]string{"challenge": "chal", "salt": "salt"},
+		})
+
+		var msg message
+		var id identify
+		if err := ws.ReadJSON(&msg); err != nil || msg.Op != opIdentify {
+			t.Errorf("expected identify, got %+v (%v)", msg, err)
+			return
+		}
+		_ = json.Unmarshal(msg.D, &id)
+		if id.Authentication != auth(f.password, "salt", "chal") {
+			_ = ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(4009, "Authentication failed."))
+			return
+		}
+		send(opIdentified, map[string]int{"negotiatedRpcVersion": rpcVersion})
+
+		for {
+			if err := ws.ReadJSON(&msg); err != nil {
+				return
+			}
+			var req request
+			_ = json.Unmarshal(msg.D, &req)
+			f.requests <- req
+
+			resp := map[string]interface{}{
+				"requestType":   req.RequestType,
+				"requestId":     req.RequestID,
+				"requestStatus": map[string]interface{}{"result": true, "code": 100},
+			}
+			switch req.RequestType {
+			case "GetSceneItemId":
+				resp["responseData"] = map[string]int{"sceneItemId": 7}
+			case "GetCurrentProgramScene":
+				resp["responseData"] = map[string]string{"currentProgramSceneName": "Live"}
+			}
+			send(opResponse, resp)
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeOBS) address() string {
+	return "ws" + strings.TrimPrefix(f.URL, "http")
+}
+
+// expect checks the next request, as JSON
+func (f *fakeOBS) expect(t *testing.T, requestType, data string) {
+	t.Helper()
+	select {
+	case req := <-f.requests:
+		d, _ := json.Marshal(req.RequestData)
+		if req.RequestType != requestType || string(d) != data {
+			t.Errorf("expected %s %s, but got %s %s", requestType, data, req.RequestType, d)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected %s, but got nothing", requestType)
+	}
+}
+
+func run(t *testing.T, c *Client) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestSource(t *testing.T) {
+	f := newFakeOBS(t, "secret")
+	c := New(config.OBS{
+		Address:      f.address(),
+		Password:     "secret",
+		Deck:         "2022-06-05",
+		TextSource:   "Lyrics text",
+		LyricsSource: "Lyrics",
+	})
+
+	// only the latest state is sent, and only for the deck
+	c.Show("2022-06-05", State{Text: "one"})
+	c.Show("2022-06-05", State{Text: "two"})
+	c.Show("other", State{Text: "three"})
+	run(t, c)
+
+	f.expect(t, "SetInputSettings", `{"inputName":"Lyrics text","inputSettings":{"text":"two"},"overlay":true}`)
+	f.expect(t, "GetCurrentProgramScene", `null`)
+	f.expect(t, "GetSceneItemId", `{"sceneName":"Live","sourceName":"Lyrics"}`)
+	f.expect(t, "SetSceneItemEnabled", `{"sceneItemEnabled":true,"sceneItemId":7,"sceneName":"Live"}`)
+
+	// clearing keeps the text, and hides the source
+	c.Show("2022-06-05", State{Blank: true})
+	f.expect(t, "GetCurrentProgramScene", `null`)
+	f.expect(t, "SetSceneItemEnabled", `{"sceneItemEnabled":false,"sceneItemId":7,"sceneName":"Live"}`)
+}
+
+func TestScenes(t *testing.T) {
+	f := newFakeOBS(t, "")
+	c := New(config.OBS{
+		Address:     f.address(),
+		TextSource:  "Lyrics text",
+		LyricsScene: "Lyrics",
+		ClearScene:  "Camera",
+	})
+	run(t, c)
+
+	c.Show("any", State{Text: "one"})
+	f.expect(t, "SetInputSettings", `{"inputName":"Lyrics text","inputSettings":{"text":"one"},"overlay":true}`)
+	f.expect(t, "SetCurrentProgramScene", `{"sceneName":"Lyrics"}`)
+
+	c.Show("any", State{Blank: true})
+	f.expect(t, "SetCurrentProgramScene", `{"sceneName":"Camera"}`)
+}
+
+func TestBadPassword(t *testing.T) {
+	f := newFakeOBS(t, "secret")
+	c := New(config.OBS{Address: f.address(), Password: "wrong"})
+	if _, err := c.connect(context.Background()); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,386 @@
+// Package ot implements operational transformation on text, so several
+// people can edit the same deck at once.
+//
+// Operations use the format of ot.js: a list of retains (positive
+// numbers), deletes (negative numbers) and inserts (strings), covering the
+// whole text. Lengths are in UTF-16 code units, like JavaScript strings.
+package ot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+var (
+	errBaseLength  = errors.New("operation doesn't match the text's length")
+	errComposeLen  = errors.New("operations can't be composed: lengths don't match")
+	errTransformed = errors.New("operations can't be transformed: base lengths don't match")
+)
+
+// component is a single retain (n > 0), delete (n < 0) or insert (s)
+type component struct {
+	n int
+	s string
+}
+
+func (c component) isRetain() bool { return c.s == "" && c.n > 0 }
+func (c component) isDelete() bool { return c.s == "" && c.n < 0 }
+func (c component) isInsert() bool { return c.s != "" }
+
+// Operation changes a text of BaseLen units into one of TargetLen units
+type Operation struct {
+	ops       []component
+	BaseLen   int
+	TargetLen int
+}
+
+// Length returns the length of the text in UTF-16 code units
+func Length(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// Retain skips n units
+func (o *Operation) Retain(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.BaseLen += n
+	o.TargetLen += n
+	if last := len(o.ops) - 1; last >= 0 && o.ops[last].isRetain() {
+		o.ops[last].n += n
+	} else {
+		o.ops = append(o.ops, component{n: n})
+	}
+	return o
+}
+
+// Insert inserts the text
+func (o *Operation) Insert(s string) *Operation {
+	if s == "" {
+		return o
+	}
+	o.TargetLen += Length(s)
+	last := len(o.ops) - 1
+	switch {
+	case last >= 0 && o.ops[last].isInsert():
+		o.ops[last].s += s
+	case last >= 0 && o.ops[last].isDelete():
+		// inserts always go before deletes: both orders have the same
+		// effect, and this keeps operations comparable
+		if last > 0 && o.ops[last-1].isInsert() {
+			o.ops[last-1].s += s
+		} else {
+			o.ops = append(o.ops, o.ops[last])
+			o.ops[last] = component{s: s}
+		}
+	default:
+		o.ops = append(o.ops, component{s: s})
+	}
+	return o
+}
+
+// Delete removes n units
+func (o *Operation) Delete(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.BaseLen += n
+	if last := len(o.ops) - 1; last >= 0 && o.ops[last].isDelete() {
+		o.ops[last].n -= n
+	} else {
+		o.ops = append(o.ops, component{n: -n})
+	}
+	return o
+}
+
+// IsNoop returns true if the operation doesn't change the text
+func (o Operation) IsNoop() bool {
+	return len(o.ops) == 0 || (len(o.ops) == 1 && o.ops[0].isRetain())
+}
+
+// Apply returns the text changed by the operation
+func (o Operation) Apply(text string) (string, error) {
+	units := utf16.Encode([]rune(text))
+	if len(units) != o.BaseLen {
+		return "", errBaseLength
+	}
+
+	res := make([]uint16, 0, o.TargetLen)
+	pos := 0
+	for _, c := range o.ops {
+		switch {
+		case c.isRetain():
+			res = append(res, units[pos:pos+c.n]...)
+			pos += c.n
+		case c.isInsert():
+			res = append(res, utf16.Encode([]rune(c.s))...)
+		default:
+			pos -= c.n
+		}
+	}
+	return string(utf16.Decode(res)), nil
+}
+
+// Diff returns the operation changing `from` into `to`: what's between
+// their common start and end is replaced
+func Diff(from, to string) Operation {
+	a, b := utf16.Encode([]rune(from)), utf16.Encode([]rune(to))
+	start := 0
+	for start < len(a) && start < len(b) && a[start] == b[start] {
+		start++
+	}
+	end := 0
+	for end < len(a)-start && end < len(b)-start && a[len(a)-1-end] == b[len(b)-1-end] {
+		end++
+	}
+
+	// don't split surrogate pairs, which inserts couldn't be encoded with
+	high := func(u uint16) bool { return u >= 0xd800 && u < 0xdc00 }
+	if start > 0 && high(a[start-1]) {
+		start--
+	}
+	if end > 0 && end < len(a) && high(a[len(a)-end-1]) {
+		end--
+	}
+
+	var o Operation
+	o.Retain(start).
+		Insert(string(utf16.Decode(b[start : len(b)-end]))).
+		Delete(len(a) - start - end).
+		Retain(end)
+	return o
+}
+
+// splitInsert returns the first n units of the string, and the rest
+func splitInsert(s string, n int) (string, string) {
+	units := utf16.Encode([]rune(s))
+	return string(utf16.Decode(units[:n])), string(utf16.Decode(units[n:]))
+}
+
+// length returns the length of the component, in units
+func (c component) length() int {
+	switch {
+	case c.isInsert():
+		return Length(c.s)
+	case c.n < 0:
+		return -c.n
+	}
+	return c.n
+}
+
+// Compose returns an operation with the effect of a followed by b
+func Compose(a, b Operation) (Operation, error) {
+	var res Operation
+	if a.TargetLen != b.BaseLen {
+		return res, errComposeLen
+	}
+
+	i, j := 0, 0
+	var ca, cb *component
+	next := func(ops []component, k *int) *component {
+		if *k >= len(ops) {
+			return nil
+		}
+		c := ops[*k]
+		*k++
+		return &c
+	}
+	ca, cb = next(a.ops, &i), next(b.ops, &j)
+	for ca != nil || cb != nil {
+		switch {
+		case ca != nil && ca.isDelete():
+			res.Delete(-ca.n)
+			ca = next(a.ops, &i)
+			continue
+		case cb != nil && cb.isInsert():
+			res.Insert(cb.s)
+			cb = next(b.ops, &j)
+			continue
+		case ca == nil || cb == nil:
+			return Operation{}, errComposeLen
+		}
+
+		la, lb := ca.length(), cb.length()
+		n := la
+		if lb < n {
+			n = lb
+		}
+		switch {
+		case ca.isRetain() && cb.isRetain():
+			res.Retain(n)
+		case ca.isInsert() && cb.isRetain():
+			head, _ := splitInsert(ca.s, n)
+			res.Insert(head)
+		case ca.isRetain() && cb.isDelete():
+			res.Delete(n)
+		case ca.isInsert() && cb.isDelete():
+			// inserted, then deleted: nothing
+		}
+
+		// consume n units of each
+		if la == n {
+			ca = next(a.ops, &i)
+		} else if ca.isInsert() {
+			_, ca.s = splitInsert(ca.s, n)
+		} else {
+			ca.n -= n
+		}
+		if lb == n {
+			cb = next(b.ops, &j)
+		} else if cb.isDelete() {
+			cb.n += n
+		} else {
+			cb.n -= n
+		}
+	}
+	return res, nil
+}
+
+// Transform returns a' and b', so that applying a then b' has the same
+// effect as applying b then a'. When both insert at the same place, a's
+// text goes first.
+func Transform(a, b Operation) (Operation, Operation, error) {
+	var a1, b1 Operation
+	if a.BaseLen != b.BaseLen {
+		return a1, b1, errTransformed
+	}
+
+	i, j := 0, 0
+	next := func(ops []component, k *int) *component {
+		if *k >= len(ops) {
+			return nil
+		}
+		c := ops[*k]
+		*k++
+		return &c
+	}
+	ca, cb := next(a.ops, &i), next(b.ops, &j)
+	for ca != nil || cb != nil {
+		switch {
+		case ca != nil && ca.isInsert():
+			a1.Insert(ca.s)
+			b1.Retain(Length(ca.s))
+			ca = next(a.ops, &i)
+			continue
+		case cb != nil && cb.isInsert():
+			a1.Retain(Length(cb.s))
+			b1.Insert(cb.s)
+			cb = next(b.ops, &j)
+			continue
+		case ca == nil || cb == nil:
+			return Operation{}, Operation{}, errTransformed
+		}
+
+		la, lb := ca.length(), cb.length()
+		n := la
+		if lb < n {
+			n = lb
+		}
+		switch {
+		case ca.isRetain() && cb.isRetain():
+			a1.Retain(n)
+			b1.Retain(n)
+		case ca.isDelete() && cb.isRetain():
+			a1.Delete(n)
+		case ca.isRetain() && cb.isDelete():
+			b1.Delete(n)
+		case ca.isDelete() && cb.isDelete():
+			// both deleted the same text
+		}
+
+		if la == n {
+			ca = next(a.ops, &i)
+		} else if ca.isDelete() {
+			ca.n += n
+		} else {
+			ca.n -= n
+		}
+		if lb == n {
+			cb = next(b.ops, &j)
+		} else if cb.isDelete() {
+			cb.n += n
+		} else {
+			cb.n -= n
+		}
+	}
+	return a1, b1, nil
+}
+
+// TransformIndex returns where the position (such as a cursor) is after
+// the operation. Text inserted right at the position goes before it only
+// if `own` is true.
+func TransformIndex(index int, o Operation, own bool) int {
+	pos, res := 0, index
+	for _, c := range o.ops {
+		if pos > index || (pos == index && !own && c.isInsert()) {
+			break
+		}
+		switch {
+		case c.isRetain():
+			pos += c.n
+		case c.isInsert():
+			res += Length(c.s)
+		default:
+			n := -c.n
+			if index-pos < n {
+				n = index - pos
+			}
+			res -= n
+			pos -= c.n
+		}
+	}
+	return res
+}
+
+// MarshalJSON encodes the operation like ot.js
+func (o Operation) MarshalJSON() ([]byte, error) {
+	list := make([]any, len(o.ops))
+	for i, c := range o.ops {
+		if c.isInsert() {
+			list[i] = c.s
+		} else {
+			list[i] = c.n
+		}
+	}
+	return json.Marshal(list)
+}
+
+// UnmarshalJSON decodes an operation encoded like ot.js
+func (o *Operation) UnmarshalJSON(buf []byte) error {
+	var list []json.RawMessage
+	if err := json.Unmarshal(buf, &list); err != nil {
+		return err
+	}
+
+	*o = Operation{}
+	for _, item := range list {
+		var n int
+		if err := json.Unmarshal(item, &n); err == nil {
+			if n > 0 {
+				o.Retain(n)
+			} else if n < 0 {
+				o.Delete(-n)
+			} else {
+				return errors.New("bad operation: zero-length component")
+			}
+			continue
+		}
+
+		var s string
+		if err := json.Unmarshal(item, &s); err != nil || s == "" {
+			return fmt.Errorf("bad operation component: %s", item)
+		}
+		o.Insert(s)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package ot
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+var alphabet = []rune("abc åä\n🎵")
+
+func randomString(rnd *rand.Rand, n int) string {
+	rs := make([]rune, n)
+	for i := range rs {
+		rs[i] = alphabet[rnd.Intn(len(alphabet))]
+	}
+	return string(rs)
+}
+
+// randomOperation returns an operation on the text, which never splits
+// characters outside the BMP
+func randomOperation(rnd *rand.Rand, text string) Operation {
+	var o Operation
+	rs := []rune(text)
+	for len(rs) > 0 {
+		k := 1 + rnd.Intn(len(rs))
+		switch rnd.Intn(3) {
+		case 0:
+			o.Retain(Length(string(rs[:k])))
+		case 1:
+			o.Delete(Length(string(rs[:k])))
+		case 2:
+			o.Insert(randomString(rnd, 1+rnd.Intn(4)))
+			continue
+		}
+		rs = rs[k:]
+	}
+	if rnd.Intn(2) == 0 {
+		o.Insert(randomString(rnd, 1+rnd.Intn(4)))
+	}
+	return o
+}
+
+func apply(t *testing.T, o Operation, text string) string {
+	t.Helper()
+	res, err := o.Apply(text)
+	if err != nil {
+		t.Fatalf("applying %v to %q: %v", o.ops, text, err)
+	}
+	return res
+}
+
+func TestApply(t *testing.T) {
+	var o Operation
+	o.Retain(3).Insert("🎵 x").Delete(2).Retain(1)
+	if res := apply(t, o, "abcdef"); res != "abc🎵 xf" {
+		t.Errorf("got %q", res)
+	}
+	if o.BaseLen != 6 || o.TargetLen != 8 {
+		t.Errorf("bad lengths %d, %d", o.BaseLen, o.TargetLen)
+	}
+	if _, err := o.Apply("abc"); err == nil {
+		t.Error("expected an error for a shorter text")
+	}
+
+	// inserts go before deletes
+	var a, b Operation
+	a.Delete(2).Insert("x")
+	b.Insert("x").Delete(2)
+	if ja, _ := json.Marshal(a); string(ja) != `["x",-2]` {
+		t.Errorf("bad normalization: %s", ja)
+	} else if jb, _ := json.Marshal(b); string(jb) != string(ja) {
+		t.Errorf("expected %s, got %s", ja, jb)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var o Operation
+	if err := json.Unmarshal([]byte(`[2,"ab",-1,3]`), &o); err != nil {
+		t.Fatal(err)
+	}
+	if o.BaseLen != 6 || o.TargetLen != 7 {
+		t.Errorf("bad lengths %d, %d", o.BaseLen, o.TargetLen)
+	}
+	if buf, _ := json.Marshal(o); string(buf) != `[2,"ab",-1,3]` {
+		t.Errorf("got %s", buf)
+	}
+
+	for _, bad := range []string{`[0]`, `[""]`, `[true]`, `{}`} {
+		if err := json.Unmarshal([]byte(bad), &o); err == nil {
+			t.Errorf("expected an error for %s", bad)
+		}
+	}
+}
+
+func TestComposeAndTransform(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		text := randomString(rnd, rnd.Intn(20))
+		a := randomOperation(rnd, text)
+		afterA := apply(t, a, text)
+
+		b := randomOperation(rnd, afterA)
+		ab, err := Compose(a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := apply(t, ab, text), apply(t, b, afterA); got != want {
+			t.Fatalf("compose: got %q, want %q", got, want)
+		}
+
+		c := randomOperation(rnd, text)
+		a1, c1, err := Transform(a, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := apply(t, c1, afterA), apply(t, a1, apply(t, c, text)); got != want {
+			t.Fatalf("transform %q with %v and %v: got %q, want %q", text, a.ops, c.ops, got, want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		from := randomString(rnd, rnd.Intn(10))
+		to := apply(t, randomOperation(rnd, from), from)
+		if got := apply(t, Diff(from, to), from); got != to {
+			t.Fatalf("diff from %q to %q: got %q", from, to, got)
+		}
+	}
+	if o := Diff("🎵a", "🎶a"); o.BaseLen != 3 || o.TargetLen != 3 {
+		t.Errorf("bad diff splitting a character: %v", o.ops)
+	}
+	if buf, _ := json.Marshal(Diff("hello world", "hello, world")); string(buf) != `[5,",",6]` {
+		t.Errorf("bad diff: %s", buf)
+	}
+}
+
+func TestTransformIndex(t *testing.T) {
+	var o Operation
+	o.Retain(2).Insert("xy").Delete(2).Retain(2)
+	for _, tc := range []struct {
+		index int
+		own   bool
+		want  int
+	}{
+		{0, false, 0},
+		{2, false, 2},
+		{2, true, 4},
+		{3, false, 4}, // on deleted text
+		{5, false, 5},
+		{6, false, 6},
+	} {
+		if got := TransformIndex(tc.index, o, tc.own); got != tc.want {
+			t.Errorf("index %d (own %v): got %d, want %d", tc.index, tc.own, got, tc.want)
+		}
+	}
+}
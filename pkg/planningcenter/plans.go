@@ -0,0 +1,226 @@
+package planningcenter
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/paupin2/slides/pkg/config"
+	"github.com/paupin2/slides/pkg/data"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DeckTitleFormat = "2006-01-02"
+
+	// what ImportPlans did with each deck
+	DeckCreated   = "created"
+	DeckUpdated   = "updated"
+	DeckUnchanged = "unchanged"
+	DeckSkipped   = "skipped" // it was edited by someone, and was left alone
+)
+
+type Plan struct {
+	ID         string `json:"id"`
+	Attributes struct {
+		Title       string `json:"title"`        // "Easter",
+		SeriesTitle string `json:"series_title"` // "Holy Week",
+		SortDate    string `json:"sort_date"`    // "2022-04-17T10:00:00Z",
+		Dates       string `json:"dates"`        // "17 April 2022",
+	} `json:"attributes"`
+}
+
+func (p Plan) SortDate() time.Time {
+	t, _ := time.Parse(TimeFormat, p.Attributes.SortDate)
+	return t
+}
+
+// DeckTitle returns the title of the deck for the plan: its (local) date
+func (p Plan) DeckTitle() string {
+	return p.SortDate().Local().Format(DeckTitleFormat)
+}
+
+type Item struct {
+	ID         string `json:"id"`
+	Attributes struct {
+		Title    string `json:"title"`     // "10,000 Reasons (Bless The Lord)",
+		ItemType string `json:"item_type"` // "song", "header", "media" or "item",
+		Sequence int    `json:"sequence"`  // 3,
+	} `json:"attributes"`
+	Relationships struct {
+		Song struct {
+			Data *struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		} `json:"song"`
+	} `json:"relationships"`
+}
+
+// SongID returns the Planning Center id of the item's song, if any
+func (i Item) SongID() string {
+	if i.Relationships.Song.Data == nil {
+		return ""
+	}
+	return i.Relationships.Song.Data.ID
+}
+
+// PlanImport is what ImportPlans did with a plan
+type PlanImport struct {
+	Plan   string `json:"plan"`
+	Title  string `json:"title"`
+	Action string `json:"action"`
+}
+
+func serviceTypePath() (string, error) {
+	st := config.Config.PlanningCenter.ServiceType
+	if st == "" {
+		return "", errors.New("no service type configured")
+	}
+	return "/services/v2/service_types/" + st, nil
+}
+
+// planItems returns the plan's items, in order
+func planItems(planID string) ([]Item, error) {
+	base, err := serviceTypePath()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []Item
+	for offset := 0; ; offset += PageSize {
+		var reply struct {
+			Data []Item `json:"data"`
+		}
+		path := fmt.Sprintf("%s/plans/%s/items", base, planID)
+		if err := Call(path, vals{"per_page": PageSize, "offset": offset}, &reply); err != nil {
+			return nil, err
+		}
+		items = append(items, reply.Data...)
+		if len(reply.Data) < PageSize {
+			break
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Attributes.Sequence < items[j].Attributes.Sequence
+	})
+	return items, nil
+}
+
+// localSong returns the song with the Planning Center id, fetching it if
+// it wasn't imported yet
+func localSong(id string) (*data.Song, error) {
+	if s := data.SongByExternalID(IDPrefix + id); s != nil {
+		return s, nil
+	}
+
+	var reply struct {
+		Data Song `json:"data"`
+	}
+	if err := Call("/services/v2/songs/"+id, nil, &reply); err != nil {
+		return nil, err
+	}
+	ds, arrangements, err := reply.Data.Fetch()
+	if err != nil {
+		return nil, err
+	}
+	if err := saveSong(&ds, arrangements); err != nil {
+		return nil, err
+	}
+	return &ds, nil
+}
+
+// planText returns the deck text for the items: the songs with their
+// `(@id)` references, as when inserting them on the editor, and the other
+// items as headers
+func planText(items []Item, songs map[string]*data.Song) string {
+	var b strings.Builder
+	for _, item := range items {
+		if song := songs[item.SongID()]; song != nil {
+			fmt.Fprintf(&b, "# %s (@%d)\n%s\n\n", song.Title, song.RowID, strings.TrimSpace(song.Content))
+		} else if title := strings.TrimSpace(item.Attributes.Title); title != "" {
+			fmt.Fprintf(&b, "# %s\n\n", title)
+		}
+	}
+	return b.String()
+}
+
+// ImportPlans creates or updates the decks for the upcoming plans of the
+// configured service type. Decks edited by someone are not overwritten.
+func ImportPlans() ([]PlanImport, error) {
+	// see: https://developer.planning.center/docs/#/apps/services/2018-11-01/vertices/plan
+	base, err := serviceTypePath()
+	if err != nil {
+		return nil, err
+	}
+
+	var reply struct {
+		Data []Plan `json:"data"`
+	}
+	err = Call(base+"/plans", vals{
+		"filter":   "future",
+		"order":    "sort_date",
+		"per_page": PageSize,
+	}, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	// plans on the same day go on the same deck
+	var titles []string
+	texts := map[string]string{}
+	plans := map[string]string{}
+	for _, plan := range reply.Data {
+		items, err := planItems(plan.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		songs := map[string]*data.Song{}
+		for _, item := range items {
+			if id := item.SongID(); id != "" {
+				if songs[id], err = localSong(id); err != nil {
+					log.Err(err).Str("id", id).Msg("error loading")
+					return nil, err
+				}
+			}
+		}
+
+		title := plan.DeckTitle()
+		if _, found := texts[title]; !found {
+			titles = append(titles, title)
+		}
+		texts[title] += planText(items, songs)
+		plans[title] = plan.ID
+	}
+
+	var result []PlanImport
+	for _, title := range titles {
+		imp := PlanImport{Plan: plans[title], Title: title}
+		deck, found := data.LoadDeck(title)
+		switch {
+		case !found:
+			imp.Action = DeckCreated
+			deck = data.Deck{Title: title}
+		case deck.LastMod.ID != data.SystemUserID:
+			imp.Action = DeckSkipped
+		case deck.Text == texts[title]:
+			imp.Action = DeckUnchanged
+		default:
+			imp.Action = DeckUpdated
+		}
+
+		if imp.Action == DeckCreated || imp.Action == DeckUpdated {
+			deck.Text = texts[title]
+			deck.LastMod = data.SystemUser()
+			if err := deck.Save(); err != nil {
+				return result, err
+			}
+		}
+		log.Info().Str("title", title).Str("plan", imp.Plan).Str("action", imp.Action).Msg("imported plan")
+		result = append(result, imp)
+	}
+	return result, nil
+}
@@ -0,0 +1,31 @@
+package planningcenter
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/paupin2/slides/pkg/data"
+)
+
+func TestPlanText(t *testing.T) {
+	var items []Item
+	err := json.Unmarshal([]byte(`[
+		{"attributes": {"title": "Welcome", "item_type": "header", "sequence": 1}},
+		{"attributes": {"title": "Amazing Grace", "item_type": "song", "sequence": 2},
+			"relationships": {"song": {"data": {"type": "Song", "id": "101"}}}},
+		{"attributes": {"title": "", "item_type": "item", "sequence": 3}},
+		{"attributes": {"title": "Sermon", "item_type": "item", "sequence": 4},
+			"relationships": {"song": {"data": null}}}
+	]`), &items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	songs := map[string]*data.Song{
+		"101": {RowID: 7, Title: "Amazing Grace", Content: "Amazing grace\nhow sweet the sound\n"},
+	}
+	expected := "# Welcome\n\n# Amazing Grace (@7)\nAmazing grace\nhow sweet the sound\n\n# Sermon\n\n"
+	if actual := planText(items, songs); actual != expected {
+		t.Errorf("expected -------\n%s\nbut got -------\n%s", expected, actual)
+	}
+}
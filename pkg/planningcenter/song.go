@@ -3,6 +3,7 @@ package planningcenter
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -64,14 +65,33 @@ func (s Song) String() string {
 	return dumpJSON(s)
 }
 
-func (s Song) Fetch() (data.Song, error) {
+// cleanThemes returns the comma-separated themes, without empty ones
+func cleanThemes(themes string) string {
+	var list []string
+	for _, t := range strings.Split(themes, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			list = append(list, t)
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+// Fetch returns the song, with the content of its first arrangement with
+// any text, and all of those arrangements
+func (s Song) Fetch() (data.Song, []data.Arrangement, error) {
 	ds := data.Song{
-		RowID:      0,
-		ExternalID: IDPrefix + s.ID,
-		Title:      s.Attributes.Title,
-		Author:     s.Attributes.Author,
-		Created:    s.CreatedAt(),
-		Modified:   s.UpdatedAt(),
+		RowID:           0,
+		ExternalID:      IDPrefix + s.ID,
+		Title:           s.Attributes.Title,
+		Author:          s.Attributes.Author,
+		Created:         s.CreatedAt(),
+		Modified:        s.UpdatedAt(),
+		Copyright:       strings.TrimSpace(s.Attributes.Copyright),
+		Themes:          cleanThemes(s.Attributes.Themes),
+		Admin:           strings.TrimSpace(s.Attributes.Admin),
+		Notes:           strings.TrimSpace(s.Attributes.Notes),
+		LastScheduledAt: s.LastScheduledAt(),
+		ExternalUpdated: s.UpdatedAt(),
 	}
 
 	if s.Attributes.CcliNumber > 0 {
@@ -80,30 +100,59 @@ func (s Song) Fetch() (data.Song, error) {
 
 	var reply struct {
 		Data []struct {
+			ID         string `json:"id"`
 			Attributes struct {
+				Name     string   `json:"name"`
 				Chords   string   `json:"chord_chart"`
 				Lyrics   string   `json:"lyrics"`
 				Sequence []string `json:"sequence"`
+				Key      string   `json:"chord_chart_key"`
+				BPM      float64  `json:"bpm"`
 			} `json:"attributes"`
 		} `json:"data"`
 	}
 
+	var arrangements []data.Arrangement
 	err := Call(fmt.Sprintf("/services/v2/songs/%s/arrangements", s.ID), nil, &reply)
 	if err == nil {
-		for _, data := range reply.Data {
+		for _, arr := range reply.Data {
 			parsed := parseText(
-				data.Attributes.Chords,
-				data.Attributes.Lyrics,
-				data.Attributes.Sequence,
+				arr.Attributes.Chords,
+				arr.Attributes.Lyrics,
+				arr.Attributes.Sequence,
 			)
-			if parsed != "" {
-				ds.Content = parsed
-				break
+			if parsed == "" {
+				continue
+			}
+
+			key, tempo := arr.Attributes.Key, int(arr.Attributes.BPM+0.5)
+			if ds.Content == "" {
+				ds.Content, ds.Key, ds.Tempo = parsed, key, tempo
+			}
+			name := strings.TrimSpace(arr.Attributes.Name)
+			if name == "" {
+				name = fmt.Sprintf("Arrangement %d", len(arrangements)+1)
 			}
+			arrangements = append(arrangements, data.Arrangement{
+				ExternalID: IDPrefix + arr.ID,
+				Name:       name,
+				Key:        key,
+				Tempo:      tempo,
+				Sequence:   arr.Attributes.Sequence,
+				Content:    parsed,
+			})
 		}
 	}
 
-	return ds, err
+	return ds, arrangements, err
+}
+
+// saveSong saves the fetched song, and then its arrangements
+func saveSong(ds *data.Song, arrangements []data.Arrangement) error {
+	if !ds.Save() {
+		return errors.New("error saving")
+	}
+	return data.SaveImportedArrangements(ds.RowID, arrangements)
 }
 
 var (
@@ -88,3 +88,16 @@ CH1L2`,
 		"Intro", "Verse 1", "Chorus", "verse 2", "chorus",
 	)
 }
+
+func TestCleanThemes(t *testing.T) {
+	for themes, expected := range map[string]string{
+		", Adoration, Blessing, Christian Life, Praise": "Adoration, Blessing, Christian Life, Praise",
+		"Grace": "Grace",
+		" , ,":  "",
+		"":      "",
+	} {
+		if actual := cleanThemes(themes); actual != expected {
+			t.Errorf("cleaning %q expected %q but got %q", themes, expected, actual)
+		}
+	}
+}
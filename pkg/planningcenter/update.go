@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/paupin2/slides/pkg/config"
 	"github.com/paupin2/slides/pkg/data"
@@ -29,7 +30,7 @@ func Call(path string, params vals, reply interface{}) error {
 	msg := log.With().Str("url", path+"?"+q.Encode()).Logger()
 	cfg := config.Config.PlanningCenter
 	if cfg.AppID == "" || cfg.Secret == "" {
-		msg.Fatal().Msg("no user/password")
+		msg.Error().Msg("no user/password")
 		return errors.New("bad user/password")
 	}
 
@@ -65,11 +66,27 @@ func Call(path string, params vals, reply interface{}) error {
 	return nil
 }
 
-func Update() error {
+// watermark returns from when songs must be fetched again: up to when the
+// last successful update went. Without one, it's the zero time, so that all
+// songs are fetched.
+func watermark() time.Time {
+	cursor, _ := data.SyncCursor(IDPrefix)
+	return cursor
+}
+
+// Update fetches the songs changed since the last successful update, or all
+// of them if `full` is set.
+func Update(full bool) error {
 	// see: https://developer.planning.center/docs/#/apps/services/2018-11-01/vertices/song
-	log.Info().Msg("getting new songs")
+	var since time.Time
+	if !full {
+		since = watermark()
+	}
+	log.Info().Time("since", since).Msg("getting new songs")
+
 	inserted, updated := 0, 0
-	for offset := 0; ; offset += PageSize {
+	newest := since
+	for offset, done := 0, false; !done; offset += PageSize {
 		var reply struct {
 			Data  []Song
 			Links struct {
@@ -87,8 +104,8 @@ func Update() error {
 
 		err := Call("/services/v2/songs", vals{
 			"per_page": PageSize,
-			// "order":    "-updated_at", // most recently-updated first
-			"offset": offset,
+			"order":    "-updated_at", // most recently-updated first
+			"offset":   offset,
 		}, &reply)
 		if err != nil {
 			return err
@@ -100,13 +117,27 @@ func Update() error {
 				continue
 			}
 
+			updatedAt := song.UpdatedAt()
+			if !updatedAt.IsZero() && updatedAt.Before(since) {
+				// this and all the following ones were already synced
+				done = true
+				break
+			}
+			if updatedAt.After(newest) {
+				newest = updatedAt
+			}
+
 			existing := data.SongByExternalID(IDPrefix + song.ID)
-			if existing != nil && existing.Modified.After(song.UpdatedAt()) {
-				// local version is more recent
+			if existing != nil && existing.LastMod.ID != data.SystemUserID {
+				// changed locally since it was imported
+				continue
+			}
+			if !full && existing != nil && !updatedAt.After(existing.ExternalUpdated) {
+				// already up to date
 				continue
 			}
 
-			ds, err := song.Fetch()
+			ds, arrangements, err := song.Fetch()
 			if err != nil {
 				log.Err(err).Str("id", song.ID).Msg("error loading")
 				return err
@@ -121,8 +152,8 @@ func Update() error {
 			// 	continue
 			// }
 
-			if !ds.Save() {
-				return errors.New("error saving")
+			if err := saveSong(&ds, arrangements); err != nil {
+				return err
 			}
 			if existing != nil {
 				updated++
@@ -133,10 +164,16 @@ func Update() error {
 
 		if len(reply.Data) < PageSize {
 			// not a full page: we've reached the end
-			break
+			done = true
 		}
 	}
-	log.Info().Int("inserted", inserted).Int("updated", updated).Msg("done")
-	return nil
 
+	// only move the cursor once everything up to it was saved
+	if !newest.IsZero() {
+		if err := data.SaveSyncCursor(IDPrefix, newest); err != nil {
+			return err
+		}
+	}
+	log.Info().Int("inserted", inserted).Int("updated", updated).Time("cursor", newest).Msg("done")
+	return nil
 }
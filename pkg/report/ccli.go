@@ -0,0 +1,75 @@
+// Package report summarizes what was sung, for licensing
+package report
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/paupin2/slides/pkg/data"
+)
+
+const dayFormat = "2006-01-02"
+
+// DefaultMonths is the period reported by default, up to today: the usual
+// CCLI reporting period
+const DefaultMonths = 6
+
+var (
+	errBadFrom   = errors.New("bad start date, expected YYYY-MM-DD")
+	errBadTo     = errors.New("bad end date, expected YYYY-MM-DD")
+	errBadPeriod = errors.New("the start date is after the end date")
+)
+
+// Period parses the first and last days of a report (inclusive), like
+// "2022-06-05". If `to` is empty it's today, and if `from` is empty it's
+// DefaultMonths before `to`.
+func Period(from, to string) (time.Time, time.Time, error) {
+	var start, end time.Time
+	if to == "" {
+		end, _ = time.Parse(dayFormat, time.Now().Format(dayFormat))
+	} else if t, err := time.Parse(dayFormat, to); err == nil {
+		end = t
+	} else {
+		return start, end, errBadTo
+	}
+
+	if from == "" {
+		start = end.AddDate(0, 0, 1).AddDate(0, -DefaultMonths, 0)
+	} else if t, err := time.Parse(dayFormat, from); err == nil {
+		start = t
+	} else {
+		return start, end, errBadFrom
+	}
+
+	if start.After(end) {
+		return start, end, errBadPeriod
+	}
+	return start, end, nil
+}
+
+// ccliHeader are the columns of CCLI reports
+var ccliHeader = []string{"Song Title", "CCLI Song Number", "Author", "Times Used"}
+
+// CCLI writes the song counts as CSV, like CCLI expects them. Songs without
+// a CCLI number (like public domain ones) aren't reported.
+func CCLI(w io.Writer, counts []data.SongCount) error {
+	var rows [][]string
+	for _, c := range counts {
+		if c.CCLI == "" {
+			continue
+		}
+		rows = append(rows, []string{c.Title, c.CCLI, c.Author, strconv.Itoa(c.Count)})
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(ccliHeader); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
@@ -0,0 +1,47 @@
+package report
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/paupin2/slides/pkg/data"
+)
+
+func TestPeriod(t *testing.T) {
+	from, to, err := Period("2022-01-02", "2022-06-30")
+	if err != nil || from.Format(dayFormat) != "2022-01-02" || to.Format(dayFormat) != "2022-06-30" {
+		t.Errorf("bad period: %v - %v, %v", from, to, err)
+	}
+	if from, _, err = Period("", "2022-06-30"); err != nil || from.Format(dayFormat) != "2022-01-01" {
+		t.Errorf("bad default start: %v, %v", from, err)
+	}
+	if _, to, err = Period("", ""); err != nil || to.Format(dayFormat) != time.Now().Format(dayFormat) {
+		t.Errorf("bad default end: %v, %v", to, err)
+	}
+
+	for _, bad := range [][2]string{{"2022-13-01", ""}, {"", "June"}, {"2022-06-30", "2022-06-01"}} {
+		if _, _, err := Period(bad[0], bad[1]); err == nil {
+			t.Errorf("expected an error for %v", bad)
+		}
+	}
+}
+
+func TestCCLI(t *testing.T) {
+	var buf bytes.Buffer
+	err := CCLI(&buf, []data.SongCount{
+		{ID: 1, Title: "Amazing Grace", Author: "John Newton", CCLI: "22025", Count: 2},
+		{ID: 2, Title: "Be Thou My Vision", Author: "Traditional", Count: 1},
+		{ID: 3, Title: "Great Is Thy Faithfulness", Author: "Chisholm, Thomas; Runyan, William", CCLI: "18723", Count: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Song Title,CCLI Song Number,Author,Times Used\n" +
+		"Amazing Grace,22025,John Newton,2\n" +
+		"Great Is Thy Faithfulness,18723,\"Chisholm, Thomas; Runyan, William\",1\n"
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
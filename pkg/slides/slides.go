@@ -0,0 +1,194 @@
+// Package slides converts deck and song text into slides. It mirrors
+// Slide.Parse on static/classes.js, so both sides see the same slides.
+package slides
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Slide is a block of text shown at once on the screen
+type Slide struct {
+	Headers  []string `json:"headers"`
+	Text     string   `json:"text"`
+	Start    int      `json:"start"` // offset (in characters) of the slide on the source
+	End      int      `json:"end"`
+	Subtitle bool     `json:"subtitle"`
+}
+
+// IsSubtitle returns true if the slide should be shown as subtitles
+func (s Slide) IsSubtitle() bool {
+	return strings.Split(s.Text, "\n")[0] == "_"
+}
+
+var (
+	reChord   = regexp.MustCompile(`^[A-G](##?|bb?)?((m|sus|maj|min|aug|dim)?\d?)?\.?$`)
+	reChordWS = regexp.MustCompile(`[\s/|]+`)
+
+	reCleanups = []struct {
+		from  *regexp.Regexp
+		to    string
+		first bool // replace only the first match
+	}{
+		{regexp.MustCompile(`(?i)\(repeat.*?\)`), "", false},
+		{regexp.MustCompile(`(?i)\bcolumn_break\b`), "", false},
+		{regexp.MustCompile(`(?i)\[[A-G](##?|bb?)?((m|sus|maj|min|aug|dim)?\d?)?\.?\]`), "", false},
+		// [G ///  | C2/G/ |]
+		// [G///   | C2///   | 2x|]
+		// You [Dadd4]face
+		{regexp.MustCompile(`\[(([A-G][a-z0-9]{0,4}|[0-9]x)[|/\s]*)+\]`), "", true},
+		{regexp.MustCompile(`\s{2,}`), " ", false},
+		{regexp.MustCompile(` +- +`), "", false}, // join syllable split: "sna - ror" -> "snaror"
+	}
+
+	reSongRef = regexp.MustCompile(`^(.*?)\s*\(@([0-9]+)\)\s*$`)
+
+	reTitle = regexp.MustCompile(`(?i)^(?:([a-zåäö0-9]+(?:\s+[a-zåäö0-9]+)?):$|^#+(.*)|^\[?((?:intro|outro|chorus|bridge|verse)(?:\s*\d+)?(?:\s*[0-9]x)?)\]?$)`)
+)
+
+// IsChordLine returns true if the line contains only chords
+func IsChordLine(line string) bool {
+	anyChord := false
+	for _, word := range reChordWS.Split(line, -1) {
+		if word == "" {
+			continue
+		}
+		if !reChord.MatchString(word) {
+			return false
+		}
+		anyChord = true
+	}
+	return anyChord
+}
+
+// CleanLine removes markings that are not shown on slides
+func CleanLine(line string) string {
+	line = strings.TrimSpace(line)
+	for _, c := range reCleanups {
+		if !c.first {
+			line = c.from.ReplaceAllString(line, c.to)
+		} else if loc := c.from.FindStringIndex(line); loc != nil {
+			line = line[:loc[0]] + c.to + line[loc[1]:]
+		}
+	}
+	return line
+}
+
+// Title returns the header on the line, if the line is a title
+func Title(line string) (title string, isTitle bool) {
+	m := reTitle.FindStringSubmatchIndex(line)
+	if m == nil {
+		return "", false
+	}
+
+	// use the first matched group as the header
+	for i := 2; i < len(m); i += 2 {
+		if m[i] >= 0 {
+			return strings.TrimSpace(line[m[i]:m[i+1]]), true
+		}
+	}
+	return "", true
+}
+
+// SongRef returns the title and song id on a header such as "Title (@12)",
+// as inserted when adding a song to a deck
+func SongRef(header string) (title string, id int, found bool) {
+	m := reSongRef.FindStringSubmatch(header)
+	if m == nil {
+		return header, 0, false
+	}
+	id, err := strconv.Atoi(m[2])
+	if err != nil {
+		return header, 0, false
+	}
+	return m[1], id, true
+}
+
+// SongIDs returns the ids of the songs referenced on the slides' headers,
+// in order and without repetitions
+func SongIDs(ss []Slide) []int {
+	var ids []int
+	seen := map[int]bool{}
+	for _, s := range ss {
+		for _, h := range s.Headers {
+			if _, id, found := SongRef(h); found && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// Parse converts the text to slides.
+//
+// Each line is trimmed and cleaned, and lines with only chords are ignored.
+// Then each block of text with at least one empty line between them is
+// considered a separate slide, similar to markdown. Titles (see Title) are
+// added as headers to the next slide.
+func Parse(text string) []Slide {
+	var (
+		slides             []Slide
+		lines, headers     []string
+		slideStart, offset int
+	)
+
+	addCurrent := func() {
+		if len(lines) == 0 {
+			return
+		}
+		slide := Slide{
+			Headers: append([]string{}, headers...),
+			Text:    strings.Join(lines, "\n"),
+			Start:   slideStart,
+			End:     offset,
+		}
+		slide.Subtitle = slide.IsSubtitle()
+		slides = append(slides, slide)
+		headers, lines = headers[:0], lines[:0]
+		slideStart = offset
+	}
+
+	parseLine := func(line string) {
+		if line = CleanLine(line); IsChordLine(line) {
+			return
+		}
+
+		// empty line or title? start a new slide
+		title, isTitle := Title(line)
+		if isTitle || line == "" {
+			addCurrent()
+			if isTitle {
+				headers = append(headers, title)
+			}
+			return
+		}
+
+		lines = append(lines, line)
+	}
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		offset += len([]rune(line))
+		parseLine(line)
+	}
+	addCurrent()
+
+	if slides == nil {
+		slides = []Slide{}
+	}
+	return slides
+}
+
+// Cleanup parses the text again, removing anything that doesn't appear
+// on slides.
+func Cleanup(source string) string {
+	var b strings.Builder
+	for _, s := range Parse(source) {
+		for _, h := range s.Headers {
+			b.WriteString("# " + strings.TrimSpace(h) + "\n")
+		}
+		b.WriteString(strings.TrimSpace(s.Text) + "\n\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,78 @@
+package slides
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsChordLine(t *testing.T) {
+	check := func(expected bool, lines ...string) {
+		t.Helper()
+		for _, line := range lines {
+			if actual := IsChordLine(line); actual != expected {
+				t.Errorf(`for "%s" expected %v but got %v`, line, expected, actual)
+			}
+		}
+	}
+
+	check(true, "G", "Am  C  D", "G/B | C", "F#m7 Bb", "Dsus4 D", "C.")
+	check(false, "", "   ", "Amazing grace", "A day", "H", "Gadd9x")
+}
+
+func TestTitle(t *testing.T) {
+	check := func(line, expected string, isTitle bool) {
+		t.Helper()
+		title, ok := Title(line)
+		if title != expected || ok != isTitle {
+			t.Errorf(`for "%s" expected "%s"/%v but got "%s"/%v`, line, expected, isTitle, title, ok)
+		}
+	}
+
+	check("# Amazing grace (@12)", "Amazing grace (@12)", true)
+	check("## ", "", true)
+	check("Verse 1:", "Verse 1", true)
+	check("Förspel:", "Förspel", true)
+	check("chorus", "chorus", true)
+	check("[Bridge 2x]", "Bridge 2x", true)
+	check("Amazing grace", "", false)
+	check("one two three:", "", false)
+}
+
+func TestParse(t *testing.T) {
+	text := "# Song (@3)\nVerse 1:\nG   C\nLine [G]one\nLine  two\n\n\n_\nsub - title\n\nChorus\nLast (repeat 2x)"
+	expected := []Slide{
+		{Headers: []string{"Song (@3)", "Verse 1"}, Text: "Line one\nLine two", Start: 0, End: 50},
+		{Headers: []string{}, Text: "_\nsubtitle", Start: 50, End: 66, Subtitle: true},
+		{Headers: []string{"Chorus"}, Text: "Last ", Start: 66, End: 89},
+	}
+
+	actual := Parse(text)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected:\n%+v\nbut got:\n%+v", expected, actual)
+	}
+
+	if actual := Parse(""); actual == nil || len(actual) != 0 {
+		t.Errorf("expected no slides, but got %+v", actual)
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	expected := "# Verse\nOne\ntwo\n\n# Chorus\nThree\n\n"
+	if actual := Cleanup("Verse\nOne\nD  A\ntwo\n[Chorus]\nThree"); actual != expected {
+		t.Errorf("expected:\n%s\nbut got:\n%s", expected, actual)
+	}
+}
+
+func TestSongIDs(t *testing.T) {
+	if title, id, found := SongRef("Amazing Grace (@12) "); !found || id != 12 || title != "Amazing Grace" {
+		t.Errorf("bad song ref: %q %d %v", title, id, found)
+	}
+	if _, _, found := SongRef("Verse (@x)"); found {
+		t.Error("expected no song ref")
+	}
+
+	ss := Parse("# One (@3)\nverse\n\n# Chorus\nchorus\n\n# Two (@1)\nfoo\n\n# One (@3)\nbar")
+	if ids := SongIDs(ss); !reflect.DeepEqual(ids, []int{3, 1}) {
+		t.Errorf("expected [3 1], but got %v", ids)
+	}
+}